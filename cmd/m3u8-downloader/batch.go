@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"m3u8-downloader/internal/core"
+	"m3u8-downloader/internal/errors"
+)
+
+// runBatch 按列表文件批量下载，path 为 - 时从标准输入读取
+func runBatch(path string) {
+	jobs, err := readBatchList(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintf(os.Stderr, "错误: 任务列表为空\n")
+		os.Exit(1)
+	}
+
+	// 共享的 HTTP 客户端、日志与进度输出使用不含站点档案的配置
+	cfg, configPath, _, err := buildConfig("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, closeLog, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	if configPath != "" {
+		log.Debug("使用配置文件: %s", configPath)
+	}
+
+	// 每个任务按自己的地址匹配站点档案，再应用列表中的覆盖项
+	for n, job := range jobs {
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("%s_%03d", *oFlag, n+1)
+		}
+
+		jobCfg, _, profile, err := buildConfig(job.URL)
+		if err == nil {
+			err = core.ApplyOverrides(jobCfg, resolveOverrides(job.Overrides))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 第 %d 行: %v\n", job.Line, err)
+			os.Exit(1)
+		}
+		if profile != nil {
+			log.Debug("第 %d 行使用配置档案: %s", job.Line, profile.Name)
+		}
+		job.Config = jobCfg
+	}
+
+	batch, err := core.NewBatch(cfg, log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 初始化批量下载失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signalContext(log)
+	defer stop()
+	stopReload := reloadOnHangup(batch, "", log)
+	defer stopReload()
+
+	results := batch.Run(ctx, jobs)
+	printBatchSummary(os.Stdout, results)
+
+	if code := batchExitCode(results); code != 0 {
+		stopReload()
+		stop()
+		closeLog()
+		os.Exit(code)
+	}
+}
+
+// readBatchList 读取并解析任务列表
+func readBatchList(path string) ([]*core.BatchJob, error) {
+	if path == "-" {
+		return core.ParseBatchList(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(errors.FileRead, "打开任务列表失败", err)
+	}
+	defer f.Close()
+
+	return core.ParseBatchList(f)
+}
+
+// resolveOverrides 把覆盖项中的命令行参数名 (如 quality, -referer) 换成配置项名
+func resolveOverrides(overrides map[string]string) map[string]string {
+	resolved := make(map[string]string, len(overrides))
+	for key, value := range overrides {
+		key = strings.TrimLeft(key, "-")
+		if k, ok := flagKeys[key]; ok {
+			key = k
+		}
+		resolved[key] = value
+	}
+	return resolved
+}
+
+// printBatchSummary 输出每个任务的结果
+func printBatchSummary(out io.Writer, results []core.BatchResult) {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	fmt.Fprintf(out, "\n批量下载结果: 成功 %d, 失败 %d\n", len(results)-failed, failed)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tNAME\tSTATUS\tELAPSED\tERROR")
+	for _, r := range results {
+		status, detail := "ok", ""
+		if r.Err != nil {
+			status, detail = "failed", r.Err.Error()
+			if isCanceled(r.Err) {
+				status = "canceled"
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%.1fs\t%s\n", r.Job.Line, r.Job.Name, status, r.Elapsed.Seconds(), detail)
+	}
+	w.Flush()
+}
+
+// batchExitCode 有任务被中断时返回 130，有任务失败时返回 1，全部成功返回 0
+func batchExitCode(results []core.BatchResult) int {
+	code := 0
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+		case isCanceled(r.Err):
+			return 130
+		default:
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/core"
+	"m3u8-downloader/internal/daemon"
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/metrics"
+	"m3u8-downloader/internal/progress"
+)
+
+// apiTokenEnv REST 接口的访问令牌，设置后请求需携带 "Authorization: Bearer <令牌>"
+const apiTokenEnv = config.EnvPrefix + "API_TOKEN"
+
+// runDaemon 启动守护进程: daemon [选项]，serve 为 true 时同时在 -listen 上提供 REST 接口
+//
+// 下载相关的选项作为所有任务的默认配置，每个任务仍按自己的地址匹配站点档案。
+func runDaemon(args []string, serve bool) {
+	if extra := parseArgs(args); extra != "" {
+		if serve {
+			fmt.Fprintf(os.Stderr, "用法: m3u8-downloader serve [-listen 地址] [-socket 路径] [-queue-file 路径] [选项]\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "用法: m3u8-downloader daemon [-socket 路径] [-queue-file 路径] [选项]\n")
+		}
+		os.Exit(1)
+	}
+
+	cfg, configPath, _, err := buildConfig("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	log, closeLog, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	if configPath != "" {
+		log.Debug("使用配置文件: %s", configPath)
+	}
+
+	fail := func(format string, err error) {
+		fmt.Fprintf(os.Stderr, "错误: "+format+"\n", err)
+		closeLog()
+		os.Exit(1)
+	}
+
+	batch, err := core.NewBatch(cfg, log)
+	if err != nil {
+		fail("初始化守护进程失败: %v", err)
+	}
+
+	store, err := daemon.OpenStore(*queueFlag)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	// 配置文件在每个任务开始时重新读取，修改后对之后的任务生效
+	configFor := func(m3u8URL string) (*config.Config, error) {
+		jobCfg, _, _, err := buildConfig(m3u8URL)
+		return jobCfg, err
+	}
+
+	d := daemon.New(store, batch, cfg, configFor, log)
+	d.SetDefaultName(*oFlag)
+	if cfg.Log.Progress == progress.ModeJSON {
+		d.SetReporter(progress.New(progress.ModeJSON))
+	}
+
+	// 套接字同时防止两个进程使用同一个队列
+	listener, err := daemon.ListenUnix(*socketFlag)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	var (
+		tcpListener, metricsListener net.Listener
+		stats                        *metrics.Metrics
+	)
+	token := os.Getenv(apiTokenEnv)
+	if serve {
+		if tcpListener, err = net.Listen("tcp", *listenFlag); err != nil {
+			listener.Close()
+			fail("%v", err)
+		}
+		// 其他机器可以访问的接口必须设置令牌
+		if token == "" && !isLoopback(tcpListener.Addr()) {
+			listener.Close()
+			tcpListener.Close()
+			fail("%v", errors.New(errors.Unauthorized,
+				fmt.Sprintf("REST 接口监听在非本地地址 %s 时必须设置 %s", tcpListener.Addr(), apiTokenEnv), nil))
+		}
+	}
+	if *metricsFlag != "" {
+		if metricsListener, err = net.Listen("tcp", *metricsFlag); err != nil {
+			listener.Close()
+			if tcpListener != nil {
+				tcpListener.Close()
+			}
+			fail("%v", err)
+		}
+		stats = metrics.New()
+		batch.SetMetrics(stats)
+	}
+
+	sigCtx, stop := signalContext(log)
+	defer stop()
+	// 接口异常退出时停止整个守护进程
+	ctx, cancel := context.WithCancel(sigCtx)
+	defer cancel()
+	stopReload := reloadOnHangup(d, "", log)
+	defer stopReload()
+
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	var wg sync.WaitGroup
+	serveOn := func(l net.Listener, handler http.Handler) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := daemon.Serve(ctx, l, handler); err != nil {
+				log.Error("%v", err)
+				cancel()
+			}
+		}()
+	}
+
+	log.Info("[守护] 监听 %s, 任务队列: %s", *socketFlag, *queueFlag)
+	serveOn(listener, d.Handler())
+
+	if tcpListener != nil {
+		log.Info("[守护] REST 接口: http://%s", tcpListener.Addr())
+		serveOn(tcpListener, daemon.RequireToken(d.Handler(), token))
+	}
+
+	if metricsListener != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", stats.Handler())
+		log.Info("[守护] 指标: http://%s/metrics", metricsListener.Addr())
+		serveOn(metricsListener, mux)
+	}
+
+	wg.Wait()
+	<-done
+}
+
+// isLoopback 检查监听地址是否只接受本机连接
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// runQueue 守护进程的客户端: queue <add|list|rm|pause|resume|cancel|priority> [参数]
+func runQueue(args []string) {
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	socket := fs.String("socket", daemon.DefaultSocketPath(), "守护进程的 Unix 套接字路径")
+	priority := fs.Int("priority", 0, "任务优先级，数值大的先运行")
+	var headers stringSlice
+	fs.Var(&headers, "H", "任务附加的请求头 \"Name: value\" (可重复)")
+	fs.Usage = queueUsage
+
+	if len(args) == 0 {
+		queueUsage()
+		os.Exit(1)
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+	rest := fs.Args()
+
+	client := daemon.NewClient(*socket)
+
+	var (
+		job daemon.Job
+		err error
+	)
+	switch command {
+	case "add":
+		if len(rest) == 0 {
+			queueUsage()
+			os.Exit(1)
+		}
+		req := daemon.AddRequest{URL: rest[0], Priority: *priority}
+		overrides := make(map[string]string)
+		for _, field := range rest[1:] {
+			if i := strings.Index(field, "="); i > 0 {
+				overrides[field[:i]] = field[i+1:]
+			} else if req.Name == "" {
+				req.Name = field
+			} else {
+				fmt.Fprintf(os.Stderr, "错误: 多余的参数 %q\n", field)
+				os.Exit(1)
+			}
+		}
+		if len(overrides) > 0 {
+			req.Overrides = resolveOverrides(overrides)
+		}
+		for _, h := range headers {
+			name, value, err := config.ParseHeader(h)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
+			if req.Headers == nil {
+				req.Headers = make(map[string]string)
+			}
+			req.Headers[name] = value
+		}
+		job, err = client.Add(req)
+	case "list", "ls":
+		var jobs []daemon.Job
+		if jobs, err = client.List(); err == nil {
+			printJobs(jobs)
+			return
+		}
+	case "rm", "pause", "resume", "cancel", "priority":
+		want := 1
+		if command == "priority" {
+			want = 2
+		}
+		if len(rest) != want {
+			queueUsage()
+			os.Exit(1)
+		}
+		id, perr := strconv.ParseInt(rest[0], 10, 64)
+		if perr != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无效的任务编号 %q\n", rest[0])
+			os.Exit(1)
+		}
+
+		switch command {
+		case "rm":
+			if err = client.Remove(id); err == nil {
+				fmt.Printf("任务 %d 已删除\n", id)
+				return
+			}
+		case "pause":
+			job, err = client.Pause(id)
+		case "resume":
+			job, err = client.Resume(id)
+		case "cancel":
+			job, err = client.Cancel(id)
+		case "priority":
+			p, perr := strconv.Atoi(rest[1])
+			if perr != nil {
+				fmt.Fprintf(os.Stderr, "错误: 无效的优先级 %q\n", rest[1])
+				os.Exit(1)
+			}
+			job, err = client.SetPriority(id, p)
+		}
+	default:
+		queueUsage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	// 暂停与取消是异步的，运行中的任务此时可能仍显示 running
+	fmt.Printf("任务 %d: %s (%s, 优先级 %d)\n", job.ID, job.Name, job.Status, job.Priority)
+}
+
+// printJobs 输出任务列表
+func printJobs(jobs []daemon.Job) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPRI\tSTATUS\tPROGRESS\tNAME\tURL")
+	for _, job := range jobs {
+		percent := "-"
+		if job.Progress != nil {
+			percent = fmt.Sprintf("%.1f%%", job.Progress.Percent)
+		}
+		detail := job.URL
+		if job.Error != "" {
+			detail = job.Error
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n", job.ID, job.Priority, job.Status, percent, job.Name, detail)
+	}
+	w.Flush()
+}
+
+func queueUsage() {
+	fmt.Fprintf(os.Stderr, `用法: m3u8-downloader queue <命令> [-socket 路径] [参数]
+
+命令:
+  add [-priority N] [-H "Name: value"] <url> [输出名] [配置项=值 ...]
+  list
+  rm <id>
+  pause <id>
+  resume <id>
+  cancel <id>
+  priority <id> <N>
+`)
+}
@@ -1,5 +1,3 @@
 module m3u8-downloader
 
 go 1.16
-
-require github.com/levigross/grequests v0.0.0-20190908174114-253788527a1a
@@ -1,6 +1,12 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config 应用程序配置
 type Config struct {
@@ -8,6 +14,11 @@ type Config struct {
 	Download DownloadConfig
 	FFmpeg   FFmpegConfig
 	Log      LogConfig
+	// Profiles 按 URL 主机匹配的站点配置，来自配置文件
+	Profiles []Profile `json:",omitempty"`
+
+	// sources 记录各配置项的来源 (配置文件、环境变量、命令行等)，不持久化
+	sources map[string]string
 }
 
 // HTTPConfig HTTP 相关配置
@@ -15,31 +26,76 @@ type HTTPConfig struct {
 	Timeout    time.Duration
 	MaxRetries int
 	UserAgent  string
+	// Proxy 代理地址 (http://, https://, socks5://)，为空时使用环境变量
+	Proxy string
+	// ProxyRules 按主机匹配的代理规则，格式为 "主机模式=代理地址"，代理地址可为 direct
+	ProxyRules []string
 }
 
 // DownloadConfig 下载相关配置
 type DownloadConfig struct {
-	MaxGoroutines      int
-	TsNameTemplate     string
-	LossTolerance      float64
+	MaxGoroutines int
+	LossTolerance float64
+	// HostType 相对路径的拼接方式: v1 相对播放列表所在目录，v2 相对站点根路径
 	HostType           string
 	SavePath           string
 	AutoClear          bool
 	InsecureSkipVerify bool
 	Cookie             string
+	Referer            string
+	Origin             string
+	// Headers 附加到播放列表、密钥和 TS 段请求的自定义请求头
+	Headers map[string]string
+	Quality string
+	// Live 直播录制模式: 持续轮询播放列表直到 ENDLIST、LiveDuration 或 Ctrl-C
+	Live         bool
+	LiveDuration time.Duration
+	// LimitRate 所有下载共享的带宽上限 (字节/秒)，0 表示不限
+	LimitRate int64
+	// HostLimitRate 每个主机单独的带宽上限 (字节/秒)，0 表示不限
+	HostLimitRate int64
+	// MaxJobs 批量下载时同时进行的任务数 (1-32)
+	MaxJobs int
 }
 
+// 合并器类型
+const (
+	// MergerAuto 优先使用 FFmpeg，找不到时退回纯 Go 的 MP4 封装
+	MergerAuto = "auto"
+	// MergerFFmpeg 使用 FFmpeg 合并为 MP4
+	MergerFFmpeg = "ffmpeg"
+	// MergerNative 纯 Go 拼接为单个 TS 文件
+	MergerNative = "native"
+	// MergerMP4 纯 Go 解复用并封装为 MP4
+	MergerMP4 = "mp4"
+)
+
 // FFmpegConfig FFmpeg 相关配置
 type FFmpegConfig struct {
+	// Enabled 为 false 时 auto 合并器不尝试 FFmpeg，直接使用纯 Go 的 MP4 封装
 	Enabled bool
 	Path    string
 	Options []string
+	// Merger 合并器类型: auto, ffmpeg, native, mp4
+	Merger string
 }
 
 // LogConfig 日志配置
 type LogConfig struct {
 	Level  string
 	Format string
+	// File 日志文件路径，为空时不写文件
+	File string
+	// FileLevel 日志文件的级别，与控制台级别相互独立
+	FileLevel string
+	// MaxSizeMB 单个日志文件的大小上限 (MB)，0 表示不轮转
+	MaxSizeMB int
+	// MaxBackups 轮转后保留的旧日志文件数量
+	MaxBackups int
+	// NoColor 关闭终端颜色，NO_COLOR 环境变量或非终端输出时也会关闭
+	NoColor bool
+	// Progress 进度输出方式: bar, json, none
+	Progress string
 }
 
 // DefaultConfig 返回默认配置
@@ -52,20 +108,26 @@ func DefaultConfig() *Config {
 		},
 		Download: DownloadConfig{
 			MaxGoroutines:      24,
-			TsNameTemplate:     "%05d.ts",
 			LossTolerance:      0.1,
 			HostType:           "v1",
 			AutoClear:          true,
 			InsecureSkipVerify: false,
+			Quality:            "best",
+			MaxJobs:            1,
 		},
 		FFmpeg: FFmpegConfig{
 			Enabled: true,
 			Path:    "ffmpeg",
 			Options: []string{"-c", "copy", "-y"},
+			Merger:  MergerAuto,
 		},
 		Log: LogConfig{
-			Level:  "info",
-			Format: "text",
+			Level:      "info",
+			Format:     "text",
+			FileLevel:  "debug",
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+			Progress:   "bar",
 		},
 	}
 }
@@ -80,15 +142,138 @@ func (c *Config) Validate() error {
 		return NewConfigError("HTTP 超时时间必须大于 0")
 	}
 
-	if c.HTTP.MaxRetries < 0 {
-		return NewConfigError("最大重试次数不能为负数")
+	if c.HTTP.MaxRetries < 1 {
+		return NewConfigError("最大重试次数必须至少为 1")
 	}
 
 	if c.Download.LossTolerance < 0 || c.Download.LossTolerance >= 1 {
 		return NewConfigError("损失率必须在 0-1 之间")
 	}
 
-	return nil
+	if _, _, err := ParseQuality(c.Download.Quality); err != nil {
+		return err
+	}
+
+	switch c.FFmpeg.Merger {
+	case "", MergerAuto, MergerFFmpeg, MergerNative, MergerMP4:
+	default:
+		return NewConfigError("合并器类型无效 (可选 auto, ffmpeg, native, mp4)")
+	}
+
+	if c.FFmpeg.Merger == MergerFFmpeg && !c.FFmpeg.Enabled {
+		return NewConfigError("合并器为 ffmpeg 时不能禁用 FFmpeg (ffmpeg.enabled)")
+	}
+
+	if c.Download.LiveDuration < 0 {
+		return NewConfigError("录制时长不能为负数")
+	}
+
+	if c.Download.MaxJobs < 1 || c.Download.MaxJobs > 32 {
+		return NewConfigError("同时进行的任务数必须在 1-32 之间")
+	}
+
+	if c.Download.LimitRate < 0 || c.Download.HostLimitRate < 0 {
+		return NewConfigError("带宽上限不能为负数")
+	}
+
+	if c.Log.Format != "" && c.Log.Format != "text" && c.Log.Format != "json" {
+		return NewConfigError("日志格式无效 (可选 text, json)")
+	}
+
+	if !validLevel(c.Log.Level) || !validLevel(c.Log.FileLevel) {
+		return NewConfigError("日志级别无效 (可选 debug, info, warn, error)")
+	}
+
+	switch c.Log.Progress {
+	case "", "bar", "json", "none":
+	default:
+		return NewConfigError("进度输出方式无效 (可选 bar, json, none)")
+	}
+
+	if c.Log.MaxSizeMB < 0 || c.Log.MaxBackups < 0 {
+		return NewConfigError("日志文件大小与保留数量不能为负数")
+	}
+
+	if c.Download.HostType != "v1" && c.Download.HostType != "v2" {
+		return NewConfigError("主机类型无效 (可选 v1, v2)")
+	}
+
+	return c.validateProfiles()
+}
+
+func validLevel(level string) bool {
+	switch level {
+	case "", "debug", "info", "warn", "error", "fatal":
+		return true
+	}
+	return false
+}
+
+// RequestHeaders 返回每个请求都要携带的请求头
+//
+// Cookie、Referer、Origin 单独设置时优先于 Headers 中的同名项。
+func (d *DownloadConfig) RequestHeaders() map[string]string {
+	headers := make(map[string]string, len(d.Headers)+3)
+	for k, v := range d.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+
+	if d.Cookie != "" {
+		headers["Cookie"] = d.Cookie
+	}
+	if d.Referer != "" {
+		headers["Referer"] = d.Referer
+	}
+	if d.Origin != "" {
+		headers["Origin"] = d.Origin
+	}
+
+	return headers
+}
+
+// ParseHeader 解析 "Name: value" 形式的请求头
+func ParseHeader(header string) (name, value string, err error) {
+	colon := strings.Index(header, ":")
+	if colon <= 0 {
+		return "", "", NewConfigError("请求头格式错误 (应为 \"Name: value\"): " + header)
+	}
+
+	name = strings.TrimSpace(header[:colon])
+	value = strings.TrimSpace(header[colon+1:])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", NewConfigError("请求头名称无效: " + header)
+	}
+
+	return textproto.CanonicalMIMEHeaderKey(name), value, nil
+}
+
+// ParseQuality 解析画质选择器: best、worst 与空值返回两个 0，<高度>p 返回高度上限，
+// <带宽>k 返回带宽上限 (bps)
+func ParseQuality(quality string) (maxHeight, maxBandwidth int, err error) {
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	switch quality {
+	case "", "best", "worst":
+		return 0, 0, nil
+	}
+
+	invalid := NewConfigError(fmt.Sprintf("画质选择器无效: %s (可选 best, worst, 720p, 1500k)", quality))
+	if len(quality) < 2 {
+		return 0, 0, invalid
+	}
+
+	n, convErr := strconv.Atoi(quality[:len(quality)-1])
+	if convErr != nil || n <= 0 {
+		return 0, 0, invalid
+	}
+
+	switch quality[len(quality)-1] {
+	case 'p':
+		return n, 0, nil
+	case 'k':
+		return 0, n * 1000, nil
+	default:
+		return 0, 0, invalid
+	}
 }
 
 // ConfigError 配置错误
@@ -59,6 +59,70 @@ func TestConfigValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "无效的画质选择器",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Download.Quality = "high"
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "JSON 日志格式",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Log.Format = "json"
+				return cfg
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "无效的日志格式",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Log.Format = "xml"
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "最大重试次数为 0",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.HTTP.MaxRetries = 0
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "同时进行的任务数为 0",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Download.MaxJobs = 0
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "禁用 FFmpeg 时使用 ffmpeg 合并器",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.FFmpeg.Enabled = false
+				cfg.FFmpeg.Merger = MergerFFmpeg
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "无效的日志文件级别",
+			cfg: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Log.FileLevel = "verbose"
+				return cfg
+			}(),
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,3 +134,77 @@ func TestConfigValidate(t *testing.T) {
 		})
 	}
 }
+
+// TestRequestHeaders 测试请求头合并
+func TestRequestHeaders(t *testing.T) {
+	d := DownloadConfig{
+		Cookie:  "session=abc",
+		Referer: "https://example.com/",
+		Headers: map[string]string{
+			"authorization": "Bearer xxx",
+			"Referer":       "https://ignored.com/",
+		},
+	}
+
+	headers := d.RequestHeaders()
+
+	want := map[string]string{
+		"Cookie":        "session=abc",
+		"Referer":       "https://example.com/",
+		"Authorization": "Bearer xxx",
+	}
+	if len(headers) != len(want) {
+		t.Errorf("期望 %d 个请求头, 得到 %v", len(want), headers)
+	}
+	for k, v := range want {
+		if headers[k] != v {
+			t.Errorf("请求头 %s 期望 %q, 得到 %q", k, v, headers[k])
+		}
+	}
+}
+
+// TestParseHeader 测试请求头参数解析
+func TestParseHeader(t *testing.T) {
+	name, value, err := ParseHeader("x-api-key:  secret:1 ")
+	if err != nil {
+		t.Fatalf("ParseHeader 失败: %v", err)
+	}
+	if name != "X-Api-Key" || value != "secret:1" {
+		t.Errorf("期望 X-Api-Key=secret:1, 得到 %s=%s", name, value)
+	}
+
+	for _, bad := range []string{"no-colon", ": value", "bad name: v"} {
+		if _, _, err := ParseHeader(bad); err == nil {
+			t.Errorf("期望 %q 解析失败", bad)
+		}
+	}
+}
+
+// TestParseQuality 测试画质选择器解析
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		quality           string
+		height, bandwidth int
+		wantErr           bool
+	}{
+		{"best", 0, 0, false},
+		{"", 0, 0, false},
+		{"Worst", 0, 0, false},
+		{"720P", 720, 0, false},
+		{"1500k", 0, 1500000, false},
+		{"high", 0, 0, true},
+		{"0p", 0, 0, true},
+		{"720x", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		height, bandwidth, err := ParseQuality(tt.quality)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQuality(%q) error = %v, wantErr %v", tt.quality, err, tt.wantErr)
+			continue
+		}
+		if height != tt.height || bandwidth != tt.bandwidth {
+			t.Errorf("ParseQuality(%q) 期望 (%d, %d), 得到 (%d, %d)", tt.quality, tt.height, tt.bandwidth, height, bandwidth)
+		}
+	}
+}
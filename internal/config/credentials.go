@@ -0,0 +1,98 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// credentialKeys 可能包含凭据的配置项: Cookie、请求头 (如 Authorization) 与带用户名密码的代理
+var credentialKeys = []string{"download.cookie", "download.headers", "http.proxy", "http.proxy_rules"}
+
+// WithoutCredentials 返回去掉凭据的副本，用于写入任务状态等持久化文件
+//
+// Cookie 与请求头被清空，代理地址去掉用户名与密码，站点档案 (可能包含 Cookie) 不保留。
+func (c *Config) WithoutCredentials() *Config {
+	clean := *c
+	clean.sources = nil
+	clean.Profiles = nil
+	clean.Download.Cookie = ""
+	clean.Download.Headers = nil
+	clean.HTTP.Proxy = stripUserinfo(c.HTTP.Proxy)
+
+	clean.HTTP.ProxyRules = nil
+	for _, rule := range c.HTTP.ProxyRules {
+		if eq := strings.Index(rule, "="); eq > 0 {
+			rule = rule[:eq+1] + stripUserinfo(rule[eq+1:])
+		}
+		clean.HTTP.ProxyRules = append(clean.HTTP.ProxyRules, rule)
+	}
+
+	return &clean
+}
+
+// CopyCredentials 把 src 中显式设置 (来源不是默认值) 的凭据配置项复制到 c
+//
+// 续传时任务状态不含凭据，由当前的配置文件、环境变量与命令行参数重新提供。
+func (c *Config) CopyCredentials(src *Config) {
+	for _, key := range credentialKeys {
+		source := src.Source(key)
+		if source == SourceDefault {
+			continue
+		}
+		f := lookupField(key)
+		// 值来自已校验的配置，重新设置不会失败
+		f.set(c, f.get(src))
+		c.MarkSource(key, source)
+	}
+}
+
+// Redact 隐藏凭据配置项的值: Cookie 与请求头的值替换为 ***，代理地址 (包括代理规则中的代理)
+// 隐藏密码；其他配置项原样返回
+func Redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+
+	switch key {
+	case "download.cookie":
+		return "***"
+	case "http.proxy":
+		return redactProxy(value)
+	case "http.proxy_rules":
+		rules := strings.Split(value, ",")
+		for i, rule := range rules {
+			if eq := strings.Index(rule, "="); eq > 0 {
+				rules[i] = rule[:eq+1] + redactProxy(rule[eq+1:])
+			}
+		}
+		return strings.Join(rules, ",")
+	case "download.headers":
+		var names []string
+		for _, line := range strings.Split(value, "\n") {
+			if colon := strings.Index(line, ":"); colon > 0 {
+				names = append(names, line[:colon]+": ***")
+			}
+		}
+		return strings.Join(names, ", ")
+	default:
+		return value
+	}
+}
+
+// redactProxy 隐藏代理地址中的密码，无法解析时原样返回
+func redactProxy(proxy string) string {
+	if u, err := url.Parse(proxy); err == nil {
+		return u.Redacted()
+	}
+	return proxy
+}
+
+// stripUserinfo 去掉代理地址中的用户名与密码，无法解析时原样返回
+func stripUserinfo(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	u.User = nil
+	return u.String()
+}
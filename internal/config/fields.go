@@ -0,0 +1,324 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配置值的来源，优先级从低到高
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceProfile = "profile"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+	// SourceJob 批量列表中单个任务的覆盖项
+	SourceJob = "job"
+)
+
+// EnvPrefix 环境变量前缀
+const EnvPrefix = "M3U8DL_"
+
+// field 一个可通过字符串读写的配置项
+//
+// key 与配置文件中的 "节.字段" 一致，环境变量名由 key 推导。
+type field struct {
+	key string
+	get func(c *Config) string
+	set func(c *Config, v string) error
+}
+
+var fields = []field{
+	durationField("http.timeout", func(c *Config) *time.Duration { return &c.HTTP.Timeout }),
+	intField("http.max_retries", func(c *Config) *int { return &c.HTTP.MaxRetries }),
+	stringField("http.user_agent", func(c *Config) *string { return &c.HTTP.UserAgent }),
+	stringField("http.proxy", func(c *Config) *string { return &c.HTTP.Proxy }),
+	listField("http.proxy_rules", ",", func(c *Config) *[]string { return &c.HTTP.ProxyRules }),
+
+	intField("download.max_goroutines", func(c *Config) *int { return &c.Download.MaxGoroutines }),
+	floatField("download.loss_tolerance", func(c *Config) *float64 { return &c.Download.LossTolerance }),
+	stringField("download.host_type", func(c *Config) *string { return &c.Download.HostType }),
+	stringField("download.save_path", func(c *Config) *string { return &c.Download.SavePath }),
+	boolField("download.auto_clear", func(c *Config) *bool { return &c.Download.AutoClear }),
+	boolField("download.insecure_skip_verify", func(c *Config) *bool { return &c.Download.InsecureSkipVerify }),
+	stringField("download.cookie", func(c *Config) *string { return &c.Download.Cookie }),
+	stringField("download.referer", func(c *Config) *string { return &c.Download.Referer }),
+	stringField("download.origin", func(c *Config) *string { return &c.Download.Origin }),
+	headersField("download.headers", func(c *Config) *map[string]string { return &c.Download.Headers }),
+	stringField("download.quality", func(c *Config) *string { return &c.Download.Quality }),
+	boolField("download.live", func(c *Config) *bool { return &c.Download.Live }),
+	durationField("download.live_duration", func(c *Config) *time.Duration { return &c.Download.LiveDuration }),
+	rateField("download.limit_rate", func(c *Config) *int64 { return &c.Download.LimitRate }),
+	rateField("download.host_limit_rate", func(c *Config) *int64 { return &c.Download.HostLimitRate }),
+	intField("download.max_jobs", func(c *Config) *int { return &c.Download.MaxJobs }),
+
+	boolField("ffmpeg.enabled", func(c *Config) *bool { return &c.FFmpeg.Enabled }),
+	stringField("ffmpeg.path", func(c *Config) *string { return &c.FFmpeg.Path }),
+	listField("ffmpeg.options", " ", func(c *Config) *[]string { return &c.FFmpeg.Options }),
+	stringField("ffmpeg.merger", func(c *Config) *string { return &c.FFmpeg.Merger }),
+
+	stringField("log.level", func(c *Config) *string { return &c.Log.Level }),
+	stringField("log.format", func(c *Config) *string { return &c.Log.Format }),
+	stringField("log.file", func(c *Config) *string { return &c.Log.File }),
+	stringField("log.file_level", func(c *Config) *string { return &c.Log.FileLevel }),
+	intField("log.max_size_mb", func(c *Config) *int { return &c.Log.MaxSizeMB }),
+	intField("log.max_backups", func(c *Config) *int { return &c.Log.MaxBackups }),
+	boolField("log.no_color", func(c *Config) *bool { return &c.Log.NoColor }),
+	stringField("log.progress", func(c *Config) *string { return &c.Log.Progress }),
+}
+
+func lookupField(key string) *field {
+	for i := range fields {
+		if fields[i].key == key {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// EnvName 返回配置项对应的环境变量名，如 download.max_goroutines -> M3U8DL_DOWNLOAD_MAX_GOROUTINES
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// Set 按字符串设置配置项并记录来源
+func (c *Config) Set(key, value, source string) error {
+	f := lookupField(key)
+	if f == nil {
+		return NewConfigError("未知的配置项: " + key)
+	}
+	if err := f.set(c, value); err != nil {
+		return NewConfigError(fmt.Sprintf("%s 的值无效 %q: %v", key, value, err))
+	}
+	c.MarkSource(key, source)
+	return nil
+}
+
+// MarkSource 记录配置项的来源，未记录的项视为默认值
+func (c *Config) MarkSource(key, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+}
+
+// Source 返回配置项的来源
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// LoadEnv 读取 M3U8DL_* 环境变量覆盖配置，空值视为未设置
+func (c *Config) LoadEnv() error {
+	for _, f := range fields {
+		value, ok := os.LookupEnv(EnvName(f.key))
+		if !ok || value == "" {
+			continue
+		}
+		if err := f.set(c, value); err != nil {
+			return NewConfigError(fmt.Sprintf("环境变量 %s 的值无效 %q: %v", EnvName(f.key), value, err))
+		}
+		c.MarkSource(f.key, SourceEnv)
+	}
+	return nil
+}
+
+// Setting 一个配置项的当前值与来源
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Env    string
+}
+
+// Settings 按定义顺序返回所有配置项的当前值与来源
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		settings = append(settings, Setting{
+			Key:    f.key,
+			Value:  f.get(c),
+			Source: c.Source(f.key),
+			Env:    EnvName(f.key),
+		})
+	}
+	return settings
+}
+
+func stringField(key string, ptr func(c *Config) *string) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return *ptr(c) },
+		set: func(c *Config, v string) error {
+			*ptr(c) = strings.TrimSpace(v)
+			return nil
+		},
+	}
+}
+
+func intField(key string, ptr func(c *Config) *int) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return strconv.Itoa(*ptr(c)) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return err
+			}
+			*ptr(c) = n
+			return nil
+		},
+	}
+}
+
+func floatField(key string, ptr func(c *Config) *float64) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return strconv.FormatFloat(*ptr(c), 'g', -1, 64) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = n
+			return nil
+		},
+	}
+}
+
+func boolField(key string, ptr func(c *Config) *bool) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return strconv.FormatBool(*ptr(c)) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return err
+			}
+			*ptr(c) = b
+			return nil
+		},
+	}
+}
+
+// durationField 接受 "30s" 形式的时长或以秒为单位的数字
+func durationField(key string, ptr func(c *Config) *time.Duration) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return ptr(c).String() },
+		set: func(c *Config, v string) error {
+			v = strings.TrimSpace(v)
+			if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+				*ptr(c) = time.Duration(seconds * float64(time.Second))
+				return nil
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = d
+			return nil
+		},
+	}
+}
+
+// rateField 接受 "5M"、"500K" 形式的带宽或以字节为单位的数字
+func rateField(key string, ptr func(c *Config) *int64) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return FormatRate(*ptr(c)) },
+		set: func(c *Config, v string) error {
+			n, err := ParseRate(v)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = n
+			return nil
+		},
+	}
+}
+
+// listField 接受 JSON 数组或以 sep 分隔的字符串 (sep 为空格时按任意空白分隔)
+func listField(key, sep string, ptr func(c *Config) *[]string) field {
+	return field{
+		key: key,
+		get: func(c *Config) string { return strings.Join(*ptr(c), sep) },
+		set: func(c *Config, v string) error {
+			v = strings.TrimSpace(v)
+			if strings.HasPrefix(v, "[") {
+				var list []string
+				if err := json.Unmarshal([]byte(v), &list); err != nil {
+					return err
+				}
+				*ptr(c) = list
+				return nil
+			}
+
+			var list []string
+			if sep == " " {
+				list = strings.Fields(v)
+			} else {
+				for _, item := range strings.Split(v, sep) {
+					if item = strings.TrimSpace(item); item != "" {
+						list = append(list, item)
+					}
+				}
+			}
+			*ptr(c) = list
+			return nil
+		},
+	}
+}
+
+// headersField 接受 JSON 对象，或以换行分隔的 "Name: value" 列表
+func headersField(key string, ptr func(c *Config) *map[string]string) field {
+	return field{
+		key: key,
+		get: func(c *Config) string {
+			headers := *ptr(c)
+			names := make([]string, 0, len(headers))
+			for name := range headers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			lines := make([]string, 0, len(names))
+			for _, name := range names {
+				lines = append(lines, textproto.CanonicalMIMEHeaderKey(name)+": "+headers[name])
+			}
+			return strings.Join(lines, "\n")
+		},
+		set: func(c *Config, v string) error {
+			v = strings.TrimSpace(v)
+			headers := make(map[string]string)
+			if strings.HasPrefix(v, "{") {
+				if err := json.Unmarshal([]byte(v), &headers); err != nil {
+					return err
+				}
+				*ptr(c) = headers
+				return nil
+			}
+
+			for _, line := range strings.Split(v, "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				name, value, err := ParseHeader(line)
+				if err != nil {
+					return err
+				}
+				headers[name] = value
+			}
+			*ptr(c) = headers
+			return nil
+		},
+	}
+}
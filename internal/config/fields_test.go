@@ -0,0 +1,129 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLoadEnv 测试环境变量覆盖配置文件并记录来源
+func TestLoadEnv(t *testing.T) {
+	path := writeConfigFile(t, `{"http": {"timeout": "15s", "max_retries": 8}}`)
+
+	setenv(t, "M3U8DL_HTTP_TIMEOUT", "30")
+	setenv(t, "M3U8DL_DOWNLOAD_AUTO_CLEAR", "false")
+	setenv(t, "M3U8DL_DOWNLOAD_HEADERS", `{"x-token": "abc"}`)
+	setenv(t, "M3U8DL_HTTP_PROXY_RULES", "*.cdn.com=direct, example.com=socks5://127.0.0.1:1080")
+	setenv(t, "M3U8DL_FFMPEG_OPTIONS", "-c copy  -y")
+	setenv(t, "M3U8DL_LOG_LEVEL", "")
+
+	cfg := DefaultConfig()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatalf("LoadEnv 失败: %v", err)
+	}
+
+	if cfg.HTTP.Timeout != 30*time.Second {
+		t.Errorf("期望环境变量覆盖配置文件, Timeout=%v", cfg.HTTP.Timeout)
+	}
+	if cfg.HTTP.MaxRetries != 8 {
+		t.Errorf("期望保留配置文件的值, MaxRetries=%d", cfg.HTTP.MaxRetries)
+	}
+	if cfg.Download.AutoClear {
+		t.Error("期望 AutoClear=false")
+	}
+	if cfg.Download.RequestHeaders()["X-Token"] != "abc" {
+		t.Errorf("请求头未生效: %v", cfg.Download.Headers)
+	}
+	if len(cfg.HTTP.ProxyRules) != 2 || cfg.HTTP.ProxyRules[0] != "*.cdn.com=direct" {
+		t.Errorf("代理规则解析错误: %q", cfg.HTTP.ProxyRules)
+	}
+	if len(cfg.FFmpeg.Options) != 3 {
+		t.Errorf("FFmpeg 参数解析错误: %q", cfg.FFmpeg.Options)
+	}
+
+	sources := map[string]string{
+		"http.timeout":        SourceEnv,
+		"http.max_retries":    SourceFile,
+		"http.user_agent":     SourceDefault,
+		"download.headers":    SourceEnv,
+		"log.level":           SourceDefault,
+		"ffmpeg.options":      SourceEnv,
+		"download.live":       SourceDefault,
+		"download.quality":    SourceDefault,
+		"download.auto_clear": SourceEnv,
+	}
+	for key, want := range sources {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("%s 期望来源 %s, 得到 %s", key, want, got)
+		}
+	}
+}
+
+// TestLoadEnvInvalid 测试无效的环境变量值报错
+func TestLoadEnvInvalid(t *testing.T) {
+	setenv(t, "M3U8DL_DOWNLOAD_MAX_GOROUTINES", "many")
+
+	if err := DefaultConfig().LoadEnv(); err == nil {
+		t.Error("期望无效值报错")
+	}
+}
+
+// TestSettings 测试每个配置项都有环境变量与可读取的值
+func TestSettings(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.Set("download.max_goroutines", "8", SourceFlag); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("download.unknown", "1", SourceFlag); err == nil {
+		t.Error("期望未知配置项报错")
+	}
+
+	for _, s := range cfg.Settings() {
+		if s.Env != EnvName(s.Key) {
+			t.Errorf("%s 环境变量名错误: %s", s.Key, s.Env)
+		}
+		if s.Key == "download.max_goroutines" && (s.Value != "8" || s.Source != SourceFlag) {
+			t.Errorf("期望 8 (flag), 得到 %s (%s)", s.Value, s.Source)
+		}
+		if s.Key == "http.timeout" && s.Value != "5s" {
+			t.Errorf("期望 5s, 得到 %s", s.Value)
+		}
+	}
+
+	if got := EnvName("download.max_goroutines"); got != "M3U8DL_DOWNLOAD_MAX_GOROUTINES" {
+		t.Errorf("EnvName 错误: %s", got)
+	}
+}
+
+// TestParseRate 测试带宽上限的解析与格式化
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"2048", 2048},
+		{"500k", 500 << 10},
+		{"5M", 5 << 20},
+		{"1.5MB/s", 3 << 19},
+		{"1G", 1 << 30},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, 期望 %d", tt.input, got, err, tt.want)
+		}
+		if back, _ := ParseRate(FormatRate(got)); back != got {
+			t.Errorf("FormatRate(%d) = %q 无法还原", got, FormatRate(got))
+		}
+	}
+
+	for _, input := range []string{"fast", "-1M", "5X"} {
+		if _, err := ParseRate(input); err == nil {
+			t.Errorf("ParseRate(%q) 期望返回错误", input)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 配置文件名与 XDG 子目录
+const (
+	FileName = "config.json"
+	appDir   = "m3u8-downloader"
+)
+
+// fileConfig 配置文件结构，未出现的字段保持原值
+type fileConfig struct {
+	HTTP     *httpFile     `json:"http"`
+	Download *downloadFile `json:"download"`
+	FFmpeg   *ffmpegFile   `json:"ffmpeg"`
+	Log      *logFile      `json:"log"`
+	Profiles []Profile     `json:"profiles"`
+}
+
+type httpFile struct {
+	Timeout    *duration `json:"timeout"`
+	MaxRetries *int      `json:"max_retries"`
+	UserAgent  *string   `json:"user_agent"`
+	Proxy      *string   `json:"proxy"`
+	ProxyRules []string  `json:"proxy_rules"`
+}
+
+type downloadFile struct {
+	MaxGoroutines      *int              `json:"max_goroutines"`
+	LossTolerance      *float64          `json:"loss_tolerance"`
+	HostType           *string           `json:"host_type"`
+	SavePath           *string           `json:"save_path"`
+	AutoClear          *bool             `json:"auto_clear"`
+	InsecureSkipVerify *bool             `json:"insecure_skip_verify"`
+	Cookie             *string           `json:"cookie"`
+	Referer            *string           `json:"referer"`
+	Origin             *string           `json:"origin"`
+	Headers            map[string]string `json:"headers"`
+	Quality            *string           `json:"quality"`
+	Live               *bool             `json:"live"`
+	LiveDuration       *duration         `json:"live_duration"`
+	LimitRate          *rate             `json:"limit_rate"`
+	HostLimitRate      *rate             `json:"host_limit_rate"`
+	MaxJobs            *int              `json:"max_jobs"`
+}
+
+type ffmpegFile struct {
+	Enabled *bool    `json:"enabled"`
+	Path    *string  `json:"path"`
+	Options []string `json:"options"`
+	Merger  *string  `json:"merger"`
+}
+
+type logFile struct {
+	Level      *string `json:"level"`
+	Format     *string `json:"format"`
+	File       *string `json:"file"`
+	FileLevel  *string `json:"file_level"`
+	MaxSizeMB  *int    `json:"max_size_mb"`
+	MaxBackups *int    `json:"max_backups"`
+	NoColor    *bool   `json:"no_color"`
+	Progress   *string `json:"progress"`
+}
+
+// duration 支持 "30s" 形式的字符串或以秒为单位的数字
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = duration(v)
+		return nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("时长格式错误: %s", data)
+	}
+	*d = duration(seconds * float64(time.Second))
+	return nil
+}
+
+// rate 支持 "5M" 形式的字符串或以字节为单位的数字
+type rate int64
+
+func (r *rate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := ParseRate(s)
+		if err != nil {
+			return err
+		}
+		*r = rate(v)
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("带宽格式错误: %s", data)
+	}
+	*r = rate(n)
+	return nil
+}
+
+// FindFile 按 XDG 规范查找配置文件，找不到时返回空字符串
+//
+// 依次查找 $XDG_CONFIG_HOME (默认 ~/.config) 与 $XDG_CONFIG_DIRS
+// (默认 /etc/xdg) 下的 m3u8-downloader/config.json。
+func FindFile() string {
+	var dirs []string
+
+	if home := os.Getenv("XDG_CONFIG_HOME"); home != "" {
+		dirs = append(dirs, home)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config"))
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	dirs = append(dirs, filepath.SplitList(configDirs)...)
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, appDir, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// LoadFile 读取 JSON 配置文件并覆盖到 cfg 上
+//
+// 只覆盖文件中出现的字段；未知字段视为错误，避免拼写错误被静默忽略。
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NewConfigError(fmt.Sprintf("读取配置文件失败: %v", err))
+	}
+
+	var file fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return NewConfigError(fmt.Sprintf("解析配置文件 %s 失败: %v", path, err))
+	}
+
+	file.apply(c)
+	c.markFileSources(data)
+	return nil
+}
+
+// markFileSources 把配置文件中出现的配置项标记为来自文件
+func (c *Config) markFileSources(data []byte) {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return
+	}
+
+	for section, raw := range sections {
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &keys); err != nil {
+			continue
+		}
+		for key := range keys {
+			if lookupField(section+"."+key) != nil {
+				c.MarkSource(section+"."+key, SourceFile)
+			}
+		}
+	}
+}
+
+func (f *fileConfig) apply(c *Config) {
+	if h := f.HTTP; h != nil {
+		if h.Timeout != nil {
+			c.HTTP.Timeout = time.Duration(*h.Timeout)
+		}
+		setInt(&c.HTTP.MaxRetries, h.MaxRetries)
+		setString(&c.HTTP.UserAgent, h.UserAgent)
+		setString(&c.HTTP.Proxy, h.Proxy)
+		if h.ProxyRules != nil {
+			c.HTTP.ProxyRules = h.ProxyRules
+		}
+	}
+
+	if d := f.Download; d != nil {
+		setInt(&c.Download.MaxGoroutines, d.MaxGoroutines)
+		if d.LossTolerance != nil {
+			c.Download.LossTolerance = *d.LossTolerance
+		}
+		setString(&c.Download.HostType, d.HostType)
+		setString(&c.Download.SavePath, d.SavePath)
+		setBool(&c.Download.AutoClear, d.AutoClear)
+		setBool(&c.Download.InsecureSkipVerify, d.InsecureSkipVerify)
+		setString(&c.Download.Cookie, d.Cookie)
+		setString(&c.Download.Referer, d.Referer)
+		setString(&c.Download.Origin, d.Origin)
+		if d.Headers != nil {
+			c.Download.Headers = d.Headers
+		}
+		setString(&c.Download.Quality, d.Quality)
+		setBool(&c.Download.Live, d.Live)
+		if d.LiveDuration != nil {
+			c.Download.LiveDuration = time.Duration(*d.LiveDuration)
+		}
+		if d.LimitRate != nil {
+			c.Download.LimitRate = int64(*d.LimitRate)
+		}
+		if d.HostLimitRate != nil {
+			c.Download.HostLimitRate = int64(*d.HostLimitRate)
+		}
+		setInt(&c.Download.MaxJobs, d.MaxJobs)
+	}
+
+	if m := f.FFmpeg; m != nil {
+		setBool(&c.FFmpeg.Enabled, m.Enabled)
+		setString(&c.FFmpeg.Path, m.Path)
+		if m.Options != nil {
+			c.FFmpeg.Options = m.Options
+		}
+		setString(&c.FFmpeg.Merger, m.Merger)
+	}
+
+	if l := f.Log; l != nil {
+		setString(&c.Log.Level, l.Level)
+		setString(&c.Log.Format, l.Format)
+		setString(&c.Log.File, l.File)
+		setString(&c.Log.FileLevel, l.FileLevel)
+		setInt(&c.Log.MaxSizeMB, l.MaxSizeMB)
+		setInt(&c.Log.MaxBackups, l.MaxBackups)
+		setBool(&c.Log.NoColor, l.NoColor)
+		setString(&c.Log.Progress, l.Progress)
+	}
+
+	if f.Profiles != nil {
+		c.Profiles = f.Profiles
+	}
+}
+
+func setString(dst *string, v *string) {
+	if v != nil {
+		*dst = strings.TrimSpace(*v)
+	}
+}
+
+func setInt(dst *int, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv 设置环境变量并在测试结束后恢复
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// TestLoadFile 测试配置文件只覆盖出现的字段
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"http": {"timeout": "15s", "max_retries": 8, "user_agent": "test-agent"},
+		"download": {"loss_tolerance": 0.05, "auto_clear": false, "live_duration": 90},
+		"ffmpeg": {"options": ["-c", "copy", "-movflags", "+faststart", "-y"]},
+		"profiles": [{"name": "example", "hosts": ["*.example.com"], "max_goroutines": 8}]
+	}`)
+
+	cfg := DefaultConfig()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile 失败: %v", err)
+	}
+
+	if cfg.HTTP.Timeout != 15*time.Second || cfg.HTTP.MaxRetries != 8 || cfg.HTTP.UserAgent != "test-agent" {
+		t.Errorf("HTTP 配置未生效: %+v", cfg.HTTP)
+	}
+	if cfg.Download.LossTolerance != 0.05 || cfg.Download.AutoClear {
+		t.Errorf("下载配置未生效: %+v", cfg.Download)
+	}
+	if cfg.Download.LiveDuration != 90*time.Second {
+		t.Errorf("期望 LiveDuration=90s, 得到 %v", cfg.Download.LiveDuration)
+	}
+	if len(cfg.FFmpeg.Options) != 5 {
+		t.Errorf("FFmpeg 参数未生效: %v", cfg.FFmpeg.Options)
+	}
+	if cfg.Download.MaxGoroutines != 24 || cfg.Download.Quality != "best" {
+		t.Errorf("未出现的字段不应被修改: %+v", cfg.Download)
+	}
+	if len(cfg.Profiles) != 1 {
+		t.Errorf("期望 1 个配置档案, 得到 %d", len(cfg.Profiles))
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate 失败: %v", err)
+	}
+}
+
+// TestLoadFileRejectsUnknownField 测试未知字段报错
+func TestLoadFileRejectsUnknownField(t *testing.T) {
+	path := writeConfigFile(t, `{"download": {"max_gorutines": 8}}`)
+
+	if err := DefaultConfig().LoadFile(path); err == nil {
+		t.Error("期望未知字段报错")
+	}
+}
+
+// TestFindFile 测试按 XDG_CONFIG_HOME 查找配置文件
+func TestFindFile(t *testing.T) {
+	home := t.TempDir()
+	setenv(t, "XDG_CONFIG_HOME", home)
+	setenv(t, "XDG_CONFIG_DIRS", t.TempDir())
+
+	if got := FindFile(); got != "" {
+		t.Errorf("期望找不到配置文件, 得到 %s", got)
+	}
+
+	path := filepath.Join(home, appDir, FileName)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte(`{}`), 0644)
+
+	if got := FindFile(); got != path {
+		t.Errorf("期望 %s, 得到 %s", path, got)
+	}
+}
+
+// TestApplyProfile 测试按主机匹配档案并覆盖下载配置
+func TestApplyProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Download.Headers = map[string]string{"X-Global": "1", "Authorization": "old"}
+	cfg.Profiles = []Profile{
+		{Name: "other", Hosts: []string{"other.com"}, Cookie: "a=1"},
+		{
+			Name:          "example",
+			Hosts:         []string{"*.example.com"},
+			Headers:       map[string]string{"authorization": "Bearer new"},
+			Referer:       "https://www.example.com/",
+			MaxGoroutines: 8,
+			SavePath:      "/videos/example",
+		},
+	}
+
+	if p := cfg.ApplyProfile("https://unknown.org/a.m3u8"); p != nil {
+		t.Fatalf("不应匹配档案, 得到 %s", p.Name)
+	}
+
+	p := cfg.ApplyProfile("https://EXAMPLE.com:8443/live/index.m3u8")
+	if p == nil || p.Name != "example" {
+		t.Fatalf("期望匹配 example 档案, 得到 %v", p)
+	}
+
+	d := cfg.Download
+	if d.MaxGoroutines != 8 || d.SavePath != "/videos/example" || d.Referer != "https://www.example.com/" {
+		t.Errorf("档案未生效: %+v", d)
+	}
+	if d.Cookie != "" {
+		t.Errorf("未设置的字段不应覆盖, Cookie=%q", d.Cookie)
+	}
+	if d.Headers["X-Global"] != "1" || d.Headers["Authorization"] != "Bearer new" {
+		t.Errorf("请求头合并错误: %v", d.Headers)
+	}
+}
+
+// TestValidateProfiles 测试档案验证
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+	}{
+		{"缺少名称", Profile{Hosts: []string{"a.com"}}},
+		{"缺少主机", Profile{Name: "a"}},
+		{"主机模式错误", Profile{Name: "a", Hosts: []string{"[a.com"}}},
+		{"线程数越界", Profile{Name: "a", Hosts: []string{"a.com"}, MaxGoroutines: 300}},
+		{"请求头名称无效", Profile{Name: "a", Hosts: []string{"a.com"}, Headers: map[string]string{"Bad Name": "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Profiles = []Profile{tt.profile}
+			if err := cfg.Validate(); err == nil {
+				t.Error("期望验证失败")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+
+	"m3u8-downloader/internal/util"
+)
+
+// Profile 按 URL 主机匹配的站点配置
+//
+// 匹配成功时覆盖下载配置中的同名项，零值表示不覆盖；Headers 与全局
+// 请求头合并，同名时以档案为准。
+type Profile struct {
+	Name string `json:"name"`
+	// Hosts 主机模式列表，*.example.com 同时匹配 example.com 本身
+	Hosts         []string          `json:"hosts"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Cookie        string            `json:"cookie,omitempty"`
+	Referer       string            `json:"referer,omitempty"`
+	Origin        string            `json:"origin,omitempty"`
+	MaxGoroutines int               `json:"max_goroutines,omitempty"`
+	SavePath      string            `json:"save_path,omitempty"`
+}
+
+// Matches 检查 URL 的主机是否匹配档案
+func (p *Profile) Matches(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, pattern := range p.Hosts {
+		if util.MatchHost(strings.ToLower(pattern), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchProfile 返回第一个匹配 URL 的档案，没有时返回 nil
+func (c *Config) MatchProfile(rawURL string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Matches(rawURL) {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// ApplyProfile 把匹配 URL 的档案覆盖到下载配置上，返回使用的档案
+func (c *Config) ApplyProfile(rawURL string) *Profile {
+	p := c.MatchProfile(rawURL)
+	if p == nil {
+		return nil
+	}
+
+	d := &c.Download
+	source := SourceProfile + ":" + p.Name
+	if len(p.Headers) > 0 {
+		headers := make(map[string]string, len(d.Headers)+len(p.Headers))
+		for k, v := range d.Headers {
+			headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		for k, v := range p.Headers {
+			headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		d.Headers = headers
+		c.MarkSource("download.headers", source)
+	}
+	if p.Cookie != "" {
+		d.Cookie = p.Cookie
+		c.MarkSource("download.cookie", source)
+	}
+	if p.Referer != "" {
+		d.Referer = p.Referer
+		c.MarkSource("download.referer", source)
+	}
+	if p.Origin != "" {
+		d.Origin = p.Origin
+		c.MarkSource("download.origin", source)
+	}
+	if p.MaxGoroutines != 0 {
+		d.MaxGoroutines = p.MaxGoroutines
+		c.MarkSource("download.max_goroutines", source)
+	}
+	if p.SavePath != "" {
+		d.SavePath = p.SavePath
+		c.MarkSource("download.save_path", source)
+	}
+
+	return p
+}
+
+// validateProfiles 检查档案名称、主机模式与覆盖值
+func (c *Config) validateProfiles() error {
+	names := make(map[string]bool, len(c.Profiles))
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return NewConfigError("配置档案缺少名称")
+		}
+		if names[p.Name] {
+			return NewConfigError(fmt.Sprintf("配置档案 %q 重复", p.Name))
+		}
+		names[p.Name] = true
+
+		if len(p.Hosts) == 0 {
+			return NewConfigError(fmt.Sprintf("配置档案 %q 未指定 hosts", p.Name))
+		}
+		for _, pattern := range p.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return NewConfigError(fmt.Sprintf("配置档案 %q 的主机模式无效: %q", p.Name, pattern))
+			}
+		}
+
+		if p.MaxGoroutines < 0 || p.MaxGoroutines > 256 {
+			return NewConfigError(fmt.Sprintf("配置档案 %q 的下载线程数必须在 1-256 之间", p.Name))
+		}
+
+		for name := range p.Headers {
+			if name == "" || strings.ContainsAny(name, " \t:") {
+				return NewConfigError(fmt.Sprintf("配置档案 %q 的请求头名称无效: %q", p.Name, name))
+			}
+		}
+	}
+	return nil
+}
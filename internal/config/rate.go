@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 带宽单位，与 curl/wget 的 --limit-rate 一致按 1024 进位
+var rateUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseRate 解析带宽上限，如 "5M"、"500k"、"1.5MB/s" 或以字节为单位的数字，返回字节/秒
+//
+// 空字符串与 "0" 表示不限速。
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "/S")
+	v = strings.TrimSuffix(v, "B")
+	if v == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range rateUnits {
+		if strings.HasSuffix(v, unit.suffix) {
+			multiplier = unit.size
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("带宽格式错误: %s (示例: 5M, 500K)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatRate 把字节/秒格式化为 ParseRate 可以解析的形式，0 表示不限速
+func FormatRate(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	for _, unit := range rateUnits {
+		if n%unit.size == 0 {
+			return strconv.FormatInt(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,18 +13,21 @@ import (
 	httpClient "m3u8-downloader/internal/http"
 	"m3u8-downloader/internal/logger"
 	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/progress"
 	"m3u8-downloader/internal/util"
 	"m3u8-downloader/internal/video"
 )
 
 // Application 应用程序
 type Application struct {
-	cfg              *config.Config
-	logger           logger.Logger
-	httpClient       httpClient.Client
-	m3u8Fetcher      m3u8.Fetcher
-	downloadManager  *DownloadManager
-	videoMerger      video.Merger
+	cfg             *config.Config
+	logger          logger.Logger
+	httpClient      *httpClient.HTTPClient
+	m3u8Fetcher     m3u8.Fetcher
+	downloadManager *DownloadManager
+	videoMerger     video.Merger
+	mergerName      string
+	reporter        progress.Reporter
 }
 
 // NewApplication 创建新的应用程序
@@ -32,7 +37,16 @@ func NewApplication(cfg *config.Config, logger logger.Logger) (*Application, err
 		return nil, err
 	}
 
-	// 创建 HTTP 客户端
+	hc, err := NewHTTPClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return newApplication(cfg, logger, hc, progress.New(cfg.Log.Progress))
+}
+
+// NewHTTPClient 按配置创建 HTTP 客户端
+func NewHTTPClient(cfg *config.Config, logger logger.Logger) (*httpClient.HTTPClient, error) {
 	hc := httpClient.NewClient(
 		cfg.HTTP.Timeout,
 		cfg.HTTP.MaxRetries,
@@ -41,11 +55,27 @@ func NewApplication(cfg *config.Config, logger logger.Logger) (*Application, err
 	)
 
 	if cfg.Download.InsecureSkipVerify {
-		hc.(*httpClient.HTTPClient).SetInsecureVerify(true)
+		hc.SetInsecureVerify(true)
 	}
 
+	hc.SetRateLimit(cfg.Download.LimitRate)
+	hc.SetHostRateLimit(cfg.Download.HostLimitRate)
+
+	if cfg.HTTP.Proxy != "" || len(cfg.HTTP.ProxyRules) > 0 {
+		if err := hc.SetProxy(cfg.HTTP.Proxy, cfg.HTTP.ProxyRules); err != nil {
+			return nil, err
+		}
+	}
+
+	return hc, nil
+}
+
+// newApplication 使用已有的 HTTP 客户端与进度报告器创建应用程序，批量下载时多个任务共享连接池
+func newApplication(cfg *config.Config, logger logger.Logger, hc *httpClient.HTTPClient, reporter progress.Reporter) (*Application, error) {
 	// 创建 M3U8 获取器
 	m3u8Fetcher := m3u8.NewFetcher(hc, logger)
+	m3u8Fetcher.SetQuality(cfg.Download.Quality)
+	m3u8Fetcher.SetHostType(cfg.Download.HostType)
 
 	// 创建下载管理器
 	downloadManager := NewDownloadManager(
@@ -54,12 +84,12 @@ func NewApplication(cfg *config.Config, logger logger.Logger) (*Application, err
 		cfg.HTTP.MaxRetries,
 		logger,
 	)
+	downloadManager.SetHeaders(cfg.Download.RequestHeaders())
+	downloadManager.SetReporter(reporter)
 
 	// 创建视频合并器
-	videoMerger := video.NewFFmpegMerger(cfg.FFmpeg.Path, logger)
-
-	// 检查 FFmpeg
-	if err := videoMerger.CheckFFmpeg(); err != nil {
+	videoMerger, mergerName, err := NewMerger(cfg, logger)
+	if err != nil {
 		return nil, err
 	}
 
@@ -70,71 +100,261 @@ func NewApplication(cfg *config.Config, logger logger.Logger) (*Application, err
 		m3u8Fetcher:     m3u8Fetcher,
 		downloadManager: downloadManager,
 		videoMerger:     videoMerger,
+		mergerName:      mergerName,
+		reporter:        reporter,
 	}, nil
 }
 
+// SetRateLimit 调整全局与每个主机的带宽上限 (字节/秒)，0 表示不限，下载过程中调用立即生效
+func (app *Application) SetRateLimit(limitRate, hostLimitRate int64) {
+	app.httpClient.SetRateLimit(limitRate)
+	app.httpClient.SetHostRateLimit(hostLimitRate)
+	app.cfg.Download.LimitRate = limitRate
+	app.cfg.Download.HostLimitRate = hostLimitRate
+}
+
+// NewMerger 按配置创建视频合并器
+//
+// auto 模式下找不到 FFmpeg 或 ffmpeg.enabled 为 false 时先用纯 Go 封装为 MP4，
+// 无法封装 (如编码不受支持) 时再拼接为单个 TS 文件。
+func NewMerger(cfg *config.Config, logger logger.Logger) (video.Merger, string, error) {
+	switch cfg.FFmpeg.Merger {
+	case config.MergerNative:
+		return video.NewTSMerger(logger), "TS 拼接", nil
+	case config.MergerMP4:
+		return video.NewMP4Merger(logger), "MP4 封装", nil
+	case config.MergerFFmpeg:
+		ffmpegMerger := video.NewFFmpegMerger(cfg.FFmpeg.Path, logger)
+		ffmpegMerger.SetOptions(cfg.FFmpeg.Options)
+		if err := ffmpegMerger.CheckFFmpeg(); err != nil {
+			return nil, "", err
+		}
+		return ffmpegMerger, "FFmpeg", nil
+	default:
+		if cfg.FFmpeg.Enabled {
+			ffmpegMerger := video.NewFFmpegMerger(cfg.FFmpeg.Path, logger)
+			ffmpegMerger.SetOptions(cfg.FFmpeg.Options)
+			if err := ffmpegMerger.CheckFFmpeg(); err == nil {
+				return ffmpegMerger, "FFmpeg", nil
+			}
+			logger.Warn("未找到 FFmpeg (%s)，将使用纯 Go 方式封装为 MP4", cfg.FFmpeg.Path)
+		}
+		merger := video.NewFallbackMerger(video.NewMP4Merger(logger), video.NewTSMerger(logger), logger)
+		return merger, "MP4 封装", nil
+	}
+}
+
 // Run 运行应用程序
-func (app *Application) Run(m3u8URL, movieName string) error {
+//
+// ctx 取消后停止调度新的段并保存任务状态，返回 errors.Canceled 错误，之后可以续传。
+func (app *Application) Run(ctx context.Context, m3u8URL, movieName string) error {
 	startTime := time.Now()
 
-	// 1. 获取 M3U8 清单
+	// 1. 确定保存路径
+	savePath := app.cfg.Download.SavePath
+	if savePath == "" {
+		savePath, _ = os.Getwd()
+	}
+
+	downloadDir := filepath.Join(savePath, movieName)
+
+	// 2. 同一地址存在未完成的任务时直接续传，不再重新获取清单
+	if !app.cfg.Download.Live {
+		if state, err := LoadJobState(downloadDir); err == nil && state.SourceURL == m3u8URL {
+			done, remaining := state.Counts()
+			app.logger.Info("[恢复] 发现未完成的任务: 已完成 %d, 剩余 %d", done, remaining)
+			return app.runJob(ctx, state.Manifest, state, savePath, movieName, startTime)
+		}
+	}
+
+	// 3. 获取 M3U8 清单
 	app.logger.Info("[准备] 获取 M3U8 清单...")
-	manifest, err := app.m3u8Fetcher.FetchManifest(m3u8URL, app.cfg.Download.Cookie)
+	manifest, err := app.m3u8Fetcher.FetchManifest(ctx, m3u8URL, app.cfg.Download.RequestHeaders())
 	if err != nil {
 		return err
 	}
 
 	app.logger.Info("[准备] 共解析 %d 个 TS 文件", len(manifest.Segments))
 
-	// 2. 确定保存路径
-	savePath := app.cfg.Download.SavePath
-	if savePath == "" {
-		savePath, _ = os.Getwd()
+	// 直播录制的段列表持续变化，不记录任务状态
+	var state *JobState
+	if !app.cfg.Download.Live {
+		if err := util.EnsureDir(downloadDir); err != nil {
+			return err
+		}
+		state = NewJobState(downloadDir, m3u8URL, movieName, app.cfg, manifest)
+		if err := state.Save(); err != nil {
+			app.logger.Warn("[准备] 保存任务状态失败: %v", err)
+		}
+	}
+
+	return app.runJob(ctx, manifest, state, savePath, movieName, startTime)
+}
+
+// Resume 根据下载目录中的任务状态继续未完成的下载
+func (app *Application) Resume(ctx context.Context, downloadDir string) error {
+	startTime := time.Now()
+
+	downloadDir, err := filepath.Abs(downloadDir)
+	if err != nil {
+		return errors.New(errors.FileRead, "无法解析下载目录", err)
 	}
 
+	state, err := LoadJobState(downloadDir)
+	if err != nil {
+		return err
+	}
+
+	done, remaining := state.Counts()
+	app.logger.Info("[恢复] %s: 已完成 %d, 剩余 %d", state.SourceURL, done, remaining)
+
+	// 以目录名作为输出名，目录被重命名后依然可以续传
+	return app.runJob(ctx, state.Manifest, state, filepath.Dir(downloadDir), filepath.Base(downloadDir), startTime)
+}
+
+// LoadResumeConfig 读取下载目录中任务保存的配置与来源地址，供 resume 命令使用
+//
+// 保存的配置不含凭据，需要时由调用方通过 Config.CopyCredentials 补充。
+func LoadResumeConfig(downloadDir string) (*config.Config, string, error) {
+	state, err := LoadJobState(downloadDir)
+	if err != nil {
+		return nil, "", err
+	}
+	return state.Config, state.SourceURL, nil
+}
+
+// runJob 下载、验证、合并并清理一个任务
+func (app *Application) runJob(ctx context.Context, manifest *m3u8.Manifest, state *JobState, savePath, movieName string, startTime time.Time) error {
 	downloadDir := filepath.Join(savePath, movieName)
 
-	// 3. 下载 TS 文件
+	app.reportManifest(manifest)
+
+	// 1. 下载 TS 文件
 	app.logger.Info("[准备] 开始下载到: %s", downloadDir)
-	err = app.downloadManager.Download(manifest, downloadDir)
+	var err error
+	if app.cfg.Download.Live {
+		err = app.recordLive(ctx, manifest, downloadDir)
+	} else {
+		if !manifest.EndList {
+			app.logger.Warn("[准备] 播放列表缺少 #EXT-X-ENDLIST，可能是直播流，可使用 -live 持续录制")
+		}
+		app.downloadManager.SetState(state)
+		err = app.downloadManager.Download(ctx, manifest, downloadDir)
+	}
+	if stderrors.Is(err, context.Canceled) {
+		return errors.New(errors.Canceled, fmt.Sprintf("下载已中断 (可使用 resume %s 继续)", downloadDir), err)
+	}
 	if err != nil {
 		return err
 	}
 
-	// 4. 验证下载
+	// 2. 验证下载
 	app.logger.Info("[验证] 检查下载完整性...")
 	stats := app.downloadManager.GetStats()
 	expectedCount := int(stats.TotalCount)
-	successCount := int(stats.DownloadCount)
+	successCount := int(stats.DownloadCount + stats.SkippedCount)
 	allowedLoss := float64(expectedCount) * app.cfg.Download.LossTolerance
 
 	if float64(expectedCount-successCount) > allowedLoss {
 		return errors.New(errors.DownloadFailed,
-			fmt.Sprintf("下载不完整: 期望 %d, 成功 %d, 允许丢失 %.0f",
-				expectedCount, successCount, allowedLoss), nil)
+			fmt.Sprintf("下载不完整: 期望 %d, 成功 %d, 允许丢失 %.0f (可使用 resume %s 继续)",
+				expectedCount, successCount, allowedLoss, downloadDir), nil)
 	}
 
-	// 5. 合并视频
-	app.logger.Info("[合并] 使用 FFmpeg 合并视频...")
+	// 3. 合并视频
+	app.logger.Info("[合并] 使用 %s 合并视频...", app.mergerName)
 	outputPath := filepath.Join(savePath, movieName+".mp4")
+	app.reportMerge(progress.MergeStarted, outputPath, nil)
 	finalPath, err := app.videoMerger.Merge(downloadDir, outputPath)
 	if err != nil {
+		app.reportMerge(progress.MergeFinished, outputPath, err)
 		return err
 	}
+	app.reportMerge(progress.MergeFinished, finalPath, nil)
 
-	// 6. 清理临时文件
+	// 4. 清理临时文件
 	if app.cfg.Download.AutoClear {
 		app.logger.Info("[清理] 删除临时 TS 文件...")
-		util.RemoveDir(downloadDir)
+		RemoveDownloadDir(downloadDir, app.logger)
 	}
 
-	// 7. 显示完成信息
+	// 5. 显示完成信息
 	elapsed := time.Since(startTime)
 	fileSize, _ := util.GetFileSize(finalPath)
 
-	fmt.Printf("\n")
 	app.logger.Info("[成功] 视频已保存: %s", finalPath)
 	app.logger.Info("[统计] 下载耗时: %.1fs, 文件大小: %.2f MB", elapsed.Seconds(), fileSize)
 
 	return nil
 }
+
+// RemoveDownloadDir 删除下载目录中的段、任务状态与残留的临时文件，目录为空时一并删除
+//
+// 只删除下载产生的文件，输出名与已有目录重名时不会删除其中的其他文件。
+func RemoveDownloadDir(downloadDir string, log logger.Logger) {
+	files, err := util.ListTSFiles(downloadDir)
+	if err != nil {
+		log.Warn("[清理] %v", err)
+		return
+	}
+	files = append(files, StateFileName)
+	for _, name := range files {
+		if err := os.Remove(filepath.Join(downloadDir, name)); err != nil && !os.IsNotExist(err) {
+			log.Warn("[清理] 删除 %s 失败: %v", name, err)
+		}
+	}
+	if _, err := util.RemovePartFiles(downloadDir); err != nil {
+		log.Warn("[清理] %v", err)
+	}
+
+	if err := os.Remove(downloadDir); err != nil {
+		log.Warn("[清理] 下载目录中还有其他文件，保留目录: %s", downloadDir)
+	}
+}
+
+// reportManifest 通知进度报告器清单已解析
+func (app *Application) reportManifest(manifest *m3u8.Manifest) {
+	var duration float64
+	for _, segment := range manifest.Segments {
+		duration += segment.Duration
+	}
+
+	app.reporter.Report(progress.Event{
+		Type: progress.ManifestParsed,
+		Time: time.Now(),
+		Manifest: &progress.Manifest{
+			URL:      manifest.URL,
+			Segments: len(manifest.Segments),
+			Duration: duration,
+			Live:     app.cfg.Download.Live,
+		},
+	})
+}
+
+// reportMerge 通知进度报告器合并开始或结束，失败时附带原因
+func (app *Application) reportMerge(eventType progress.EventType, output string, cause error) {
+	event := progress.Event{
+		Type:  eventType,
+		Time:  time.Now(),
+		Merge: &progress.Merge{Merger: app.mergerName, Output: output},
+	}
+	if cause != nil {
+		event.Error = cause.Error()
+	}
+	app.reporter.Report(event)
+}
+
+// recordLive 录制直播流，ctx 取消 (Ctrl-C) 结束录制后继续合并已录制的段
+func (app *Application) recordLive(ctx context.Context, manifest *m3u8.Manifest, downloadDir string) error {
+	reload := func(ctx context.Context) (*m3u8.Manifest, error) {
+		return app.m3u8Fetcher.FetchManifest(ctx, manifest.URL, app.cfg.Download.RequestHeaders())
+	}
+
+	if app.cfg.Download.LiveDuration > 0 {
+		app.logger.Info("[录制] 直播模式, 录制时长上限 %s, 按 Ctrl-C 提前结束", app.cfg.Download.LiveDuration)
+	} else {
+		app.logger.Info("[录制] 直播模式, 按 Ctrl-C 结束录制")
+	}
+
+	return app.downloadManager.DownloadLive(ctx, manifest, downloadDir, reload, app.cfg.Download.LiveDuration)
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"m3u8-downloader/internal/logger"
+)
+
+// TestRemoveDownloadDir 测试清理只删除下载产生的文件，目录中还有其他文件时保留目录
+func TestRemoveDownloadDir(t *testing.T) {
+	log := logger.New("fatal")
+
+	dir := t.TempDir()
+	downloadDir := filepath.Join(dir, "movie")
+	if err := os.Mkdir(downloadDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"00000.ts", "00001.ts", StateFileName, "00002.ts.part"} {
+		if err := os.WriteFile(filepath.Join(downloadDir, name), []byte("x"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	RemoveDownloadDir(downloadDir, log)
+	if _, err := os.Stat(downloadDir); !os.IsNotExist(err) {
+		t.Errorf("下载目录应被删除: %v", err)
+	}
+
+	// 输出名与已有目录重名时只删除段
+	existing := filepath.Join(dir, "documents")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"00000.ts", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(existing, name), []byte("x"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	RemoveDownloadDir(existing, log)
+	if _, err := os.Stat(filepath.Join(existing, "notes.txt")); err != nil {
+		t.Errorf("其他文件不应被删除: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(existing, "00000.ts")); !os.IsNotExist(err) {
+		t.Errorf("段应被删除: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/errors"
+	httpClient "m3u8-downloader/internal/http"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/metrics"
+	"m3u8-downloader/internal/progress"
+)
+
+// BatchJob 批量下载列表中的一个任务
+type BatchJob struct {
+	// Line 任务在列表中的行号
+	Line int
+	URL  string
+	// Name 输出名，列表中未指定时为空，由调用方补全
+	Name string
+	// Overrides 该任务单独的配置项，键为配置项名 (如 download.quality) 或调用方定义的别名
+	Overrides map[string]string
+	// Config 任务使用的完整配置，由调用方在运行前填写
+	Config *config.Config
+}
+
+// BatchResult 一个任务的运行结果，Err 为 nil 表示成功
+type BatchResult struct {
+	Job     *BatchJob
+	Err     error
+	Elapsed time.Duration
+}
+
+// ParseBatchList 解析批量下载列表
+//
+// 每行格式为 "URL [输出名] [key=value ...]"，空行与 # 开头的行被忽略。
+func ParseBatchList(r io.Reader) ([]*BatchJob, error) {
+	var jobs []*BatchJob
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		job := &BatchJob{Line: line, URL: fields[0]}
+		if !strings.HasPrefix(job.URL, "http://") && !strings.HasPrefix(job.URL, "https://") {
+			return nil, errors.New(errors.InvalidURL, fmt.Sprintf("第 %d 行: 地址必须以 http 或 https 开头: %s", line, job.URL), nil)
+		}
+
+		for _, field := range fields[1:] {
+			if i := strings.Index(field, "="); i > 0 {
+				if job.Overrides == nil {
+					job.Overrides = make(map[string]string)
+				}
+				job.Overrides[field[:i]] = field[i+1:]
+				continue
+			}
+			if job.Name != "" {
+				return nil, errors.New(errors.InvalidConfig, fmt.Sprintf("第 %d 行: 多余的字段 %q", line, field), nil)
+			}
+			job.Name = field
+		}
+
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(errors.FileRead, "读取任务列表失败", err)
+	}
+
+	return jobs, nil
+}
+
+// ApplyOverrides 把任务单独的配置项应用到 cfg
+//
+// HTTP 连接、带宽、日志等由所有任务共享的配置不能单独设置。
+func ApplyOverrides(cfg *config.Config, overrides map[string]string) error {
+	for key, value := range overrides {
+		if sharedKey(key) {
+			return config.NewConfigError(fmt.Sprintf("%s 由所有任务共享，不能单独设置", key))
+		}
+		if err := cfg.Set(key, value, config.SourceJob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedKey 检查配置项是否作用于共享的 HTTP 客户端或整个进程
+func sharedKey(key string) bool {
+	switch key {
+	case "download.insecure_skip_verify", "download.limit_rate", "download.host_limit_rate", "download.max_jobs":
+		return true
+	}
+	return strings.HasPrefix(key, "http.") || strings.HasPrefix(key, "log.")
+}
+
+// Batch 批量下载，所有任务共享一个 HTTP 客户端 (连接池与限速器)
+type Batch struct {
+	cfg        *config.Config
+	logger     logger.Logger
+	httpClient *httpClient.HTTPClient
+	reporter   progress.Reporter
+	maxJobs    int
+	metrics    *metrics.Metrics
+}
+
+// NewBatch 按 cfg 创建共享的 HTTP 客户端与进度报告器，cfg.Download.MaxJobs 控制同时进行的任务数
+func NewBatch(cfg *config.Config, logger logger.Logger) (*Batch, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	hc, err := NewHTTPClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	maxJobs := cfg.Download.MaxJobs
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+
+	// 多个任务同时下载时终端进度条会互相覆盖，只输出任务开始与结束的日志
+	reporter := progress.New(cfg.Log.Progress)
+	if maxJobs > 1 && cfg.Log.Progress != progress.ModeJSON {
+		reporter = progress.NewSilent()
+	}
+
+	return &Batch{
+		cfg:        cfg,
+		logger:     logger,
+		httpClient: hc,
+		reporter:   reporter,
+		maxJobs:    maxJobs,
+	}, nil
+}
+
+// SetRateLimit 调整所有任务共享的带宽上限 (字节/秒)，0 表示不限
+func (b *Batch) SetRateLimit(limitRate, hostLimitRate int64) {
+	b.httpClient.SetRateLimit(limitRate)
+	b.httpClient.SetHostRateLimit(hostLimitRate)
+}
+
+// SetMetrics 设置记录所有任务运行指标的 Metrics，nil 表示不记录
+func (b *Batch) SetMetrics(m *metrics.Metrics) {
+	b.metrics = m
+	b.httpClient.SetMetrics(m)
+}
+
+// Run 按顺序启动任务，最多 maxJobs 个同时进行，返回与 jobs 一一对应的结果
+//
+// 单个任务失败不影响其他任务。ctx 取消后不再启动新任务，进行中的任务保存进度后结束。
+func (b *Batch) Run(ctx context.Context, jobs []*BatchJob) []BatchResult {
+	results := make([]BatchResult, len(jobs))
+	names := make(map[string]int, len(jobs))
+
+	limiter := make(chan struct{}, b.maxJobs)
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		results[i].Job = job
+
+		// 输出名相同的任务会写入同一个下载目录
+		if line, ok := names[job.Name]; ok {
+			results[i].Err = errors.New(errors.InvalidConfig, fmt.Sprintf("输出名 %s 与第 %d 行重复", job.Name, line), nil)
+			continue
+		}
+		names[job.Name] = job.Line
+
+		select {
+		case limiter <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i].Err = errors.New(errors.Canceled, "任务未开始", ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, job *BatchJob) {
+			defer func() {
+				wg.Done()
+				<-limiter
+			}()
+			results[i] = b.runJob(ctx, i, len(jobs), job)
+		}(i, job)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// RunJob 使用共享的 HTTP 客户端运行一个任务，进度事件发送给 reporter
+//
+// job.Config 为空时使用创建 Batch 时的配置。
+func (b *Batch) RunJob(ctx context.Context, job *BatchJob, reporter progress.Reporter) error {
+	cfg := job.Config
+	if cfg == nil {
+		cfg = b.cfg
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	app, err := newApplication(cfg, b.logger, b.httpClient, b.metrics.Reporter(reporter))
+	if err != nil {
+		return err
+	}
+	app.downloadManager.SetMetrics(b.metrics)
+
+	b.metrics.JobStarted()
+	err = app.Run(ctx, job.URL, job.Name)
+
+	result := metrics.ResultSucceeded
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		result = metrics.ResultCanceled
+	default:
+		result = metrics.ResultFailed
+	}
+	b.metrics.JobFinished(result)
+
+	return err
+}
+
+// runJob 运行批量列表中的第 i 个任务并记录结果
+func (b *Batch) runJob(ctx context.Context, i, total int, job *BatchJob) BatchResult {
+	start := time.Now()
+	result := BatchResult{Job: job}
+
+	b.logger.Info("[批量 %d/%d] 开始: %s (%s)", i+1, total, job.Name, job.URL)
+
+	result.Err = b.RunJob(ctx, job, progress.WithJob(b.reporter, job.Name))
+	result.Elapsed = time.Since(start)
+	if result.Err != nil {
+		b.logger.Error("[批量 %d/%d] 失败: %s: %v", i+1, total, job.Name, result.Err)
+	} else {
+		b.logger.Info("[批量 %d/%d] 完成: %s (%.1fs)", i+1, total, job.Name, result.Elapsed.Seconds())
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"m3u8-downloader/internal/config"
+)
+
+// TestParseBatchList 测试任务列表的解析: 注释、输出名与覆盖项
+func TestParseBatchList(t *testing.T) {
+	list := `
+# 第一季
+https://example.com/ep1.m3u8 ep01 download.quality=720p referer=https://example.com/
+https://example.com/ep2.m3u8
+`
+	jobs, err := ParseBatchList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("ParseBatchList 失败: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("期望 2 个任务, 得到 %d", len(jobs))
+	}
+
+	first := jobs[0]
+	if first.Line != 3 || first.Name != "ep01" || first.URL != "https://example.com/ep1.m3u8" {
+		t.Errorf("第一个任务解析错误: %+v", first)
+	}
+	if first.Overrides["download.quality"] != "720p" || first.Overrides["referer"] != "https://example.com/" {
+		t.Errorf("覆盖项解析错误: %v", first.Overrides)
+	}
+	if jobs[1].Name != "" || jobs[1].Overrides != nil {
+		t.Errorf("第二个任务不应有输出名与覆盖项: %+v", jobs[1])
+	}
+
+	for _, bad := range []string{"ftp://example.com/a.m3u8", "https://example.com/a.m3u8 a b"} {
+		if _, err := ParseBatchList(strings.NewReader(bad)); err == nil {
+			t.Errorf("期望 %q 解析失败", bad)
+		}
+	}
+}
+
+// TestApplyOverrides 测试覆盖项的应用与共享配置项的拒绝
+func TestApplyOverrides(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if err := ApplyOverrides(cfg, map[string]string{"download.quality": "worst"}); err != nil {
+		t.Fatalf("ApplyOverrides 失败: %v", err)
+	}
+	if cfg.Download.Quality != "worst" || cfg.Source("download.quality") != config.SourceJob {
+		t.Errorf("覆盖项未生效: %s (%s)", cfg.Download.Quality, cfg.Source("download.quality"))
+	}
+
+	for _, key := range []string{"http.proxy", "download.limit_rate", "log.level", "download.unknown"} {
+		if err := ApplyOverrides(cfg, map[string]string{key: "x"}); err == nil {
+			t.Errorf("期望拒绝 %s", key)
+		}
+	}
+}
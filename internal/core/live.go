@@ -0,0 +1,197 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/util"
+)
+
+// defaultTargetDuration 播放列表未声明 #EXT-X-TARGETDURATION 时的轮询间隔 (秒)
+const defaultTargetDuration = 10
+
+// ManifestReloader 重新获取媒体播放列表
+type ManifestReloader func(ctx context.Context) (*m3u8.Manifest, error)
+
+// DownloadLive 录制直播流
+//
+// 按 #EXT-X-TARGETDURATION 的间隔重新获取播放列表，按媒体序列号去重后下载
+// 新出现的段，直到出现 #EXT-X-ENDLIST、录制的媒体时长达到 maxDuration
+// (0 表示不限) 或 ctx 被取消为止。ctx 取消只是结束录制: 进行中的段不会被中止，
+// 返回前会等待它们下载完成，以便合并已录制的内容。
+//
+// 直播段按录制顺序重新编号，开始前会删除目录中上次录制留下的段；
+// 目录中有不是录制产生的 TS 文件时返回错误。
+func (dm *DownloadManager) DownloadLive(ctx context.Context, manifest *m3u8.Manifest, downloadDir string, reload ManifestReloader, maxDuration time.Duration) error {
+	err := util.EnsureDir(downloadDir)
+	if err != nil {
+		return err
+	}
+	if err := dm.removeSegments(downloadDir); err != nil {
+		return err
+	}
+
+	dm.beginDownload(downloadDir)
+	dm.logger.Info("开始录制直播流到 %s", downloadDir)
+
+	limiter := make(chan struct{}, dm.maxGoroutines)
+	var wg sync.WaitGroup
+
+	// 已开始的段不随 ctx 取消，保证结束录制时最后几个段完整；
+	// 等待下载许可仍使用 ctx，停止录制时不会阻塞在限制器上
+	segmentCtx := withoutCancel(ctx)
+
+	lastSequence := int64(-1)
+	recorded := 0
+	var recordedDuration float64
+	failures := 0
+
+record:
+	for {
+		newCount := 0
+		for _, segment := range manifest.Segments {
+			if segment.Sequence <= lastSequence {
+				continue
+			}
+
+			if maxDuration > 0 && recordedDuration >= maxDuration.Seconds() {
+				break
+			}
+
+			if !acquire(ctx, limiter) {
+				dm.logger.Info("收到停止信号，结束录制")
+				break record
+			}
+			lastSequence = segment.Sequence
+
+			// 直播段按录制顺序重新命名，保证合并顺序与去重无关
+			recorded++
+			segment.Name = fmt.Sprintf(dm.tsNameTemplate, recorded)
+			duration := segmentDuration(segment, manifest)
+			recordedDuration += duration
+			newCount++
+
+			dm.stats.addSegment(duration)
+			dm.runSegment(segmentCtx, &wg, limiter, recorded-1, segment, downloadDir)
+		}
+
+		if manifest.EndList {
+			dm.logger.Info("直播已结束 (#EXT-X-ENDLIST)")
+			break
+		}
+
+		if maxDuration > 0 && recordedDuration >= maxDuration.Seconds() {
+			dm.logger.Info("已达到录制时长 %s", maxDuration)
+			break
+		}
+
+		// 播放列表未变化时按目标时长的一半重新获取
+		wait := manifest.TargetDuration
+		if wait <= 0 {
+			wait = defaultTargetDuration
+		}
+		if newCount == 0 {
+			wait /= 2
+		}
+
+		select {
+		case <-ctx.Done():
+			dm.logger.Info("收到停止信号，结束录制")
+			break record
+		case <-time.After(time.Duration(wait * float64(time.Second))):
+		}
+
+		reloaded, err := reload(ctx)
+		if ctx.Err() != nil {
+			dm.logger.Info("收到停止信号，结束录制")
+			break
+		}
+		if err != nil {
+			failures++
+			if failures >= dm.maxRetries {
+				dm.logger.Error("重新获取直播播放列表连续失败 %d 次，结束录制", failures)
+				break
+			}
+			dm.logger.Warn("重新获取直播播放列表失败 (%d/%d): %v", failures, dm.maxRetries, err)
+			continue
+		}
+		failures = 0
+
+		// 媒体序列号变小说明服务端重新开始编号 (如推流重启)，按新的序列号继续录制
+		if reloaded.MediaSequence < manifest.MediaSequence {
+			dm.logger.Warn("媒体序列号从 %d 重置为 %d，继续录制新的段", manifest.MediaSequence, reloaded.MediaSequence)
+			lastSequence = reloaded.MediaSequence - 1
+		}
+		manifest = reloaded
+	}
+
+	wg.Wait()
+	dm.finishDownload()
+
+	return nil
+}
+
+// removeSegments 删除上次录制留下的段，避免被当作已下载的段跳过或混入合并结果
+//
+// 只删除符合段命名 (如 00001.ts) 的文件；目录中有其他 TS 文件时不删除任何文件并返回错误，
+// 它们不是录制产生的，合并时却会被混入结果。
+func (dm *DownloadManager) removeSegments(downloadDir string) error {
+	files, err := util.ListTSFiles(downloadDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if !dm.segmentName(name) {
+			return errors.New(errors.InvalidConfig,
+				fmt.Sprintf("目录 %s 中有不是录制产生的 TS 文件 %s，请使用其他输出名", downloadDir, name), nil)
+		}
+	}
+	for _, name := range files {
+		if err := os.Remove(filepath.Join(downloadDir, name)); err != nil {
+			return errors.New(errors.FileWrite, "删除上次录制的段失败", err)
+		}
+	}
+	if len(files) > 0 {
+		dm.logger.Warn("已删除目录中上次录制留下的 %d 个段", len(files))
+	}
+	return nil
+}
+
+// segmentName 检查文件名是否符合段的命名模板
+func (dm *DownloadManager) segmentName(name string) bool {
+	n, err := strconv.Atoi(strings.TrimSuffix(name, filepath.Ext(name)))
+	return err == nil && fmt.Sprintf(dm.tsNameTemplate, n) == name
+}
+
+// detachedContext 保留父 context 的值但不会被取消
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// withoutCancel 返回不随 ctx 取消的子 context
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// segmentDuration 返回段时长，缺少 #EXTINF 时按目标时长估算
+func segmentDuration(segment *m3u8.TsSegment, manifest *m3u8.Manifest) float64 {
+	if segment.Duration > 0 {
+		return segment.Duration
+	}
+	if manifest.TargetDuration > 0 {
+		return manifest.TargetDuration
+	}
+	return defaultTargetDuration
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"m3u8-downloader/internal/errors"
+	httpClient "m3u8-downloader/internal/http"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/progress"
+)
+
+// livePlaylist 构造直播播放列表，段 seg<N>.ts 的序列号为 N
+func livePlaylist(first, count int, endList bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:0.02\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	for seq := first; seq < first+count; seq++ {
+		fmt.Fprintf(&b, "#EXTINF:1,\nseg%d.ts\n", seq)
+	}
+	if endList {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.String()
+}
+
+// liveServer 依次返回 playlists 中的播放列表 (之后保持最后一个)，段内容的第 5 个字节为序列号
+func liveServer(t *testing.T, playlists []string) *httptest.Server {
+	var (
+		mu      sync.Mutex
+		reloads int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			mu.Lock()
+			playlist := playlists[reloads]
+			if reloads < len(playlists)-1 {
+				reloads++
+			}
+			mu.Unlock()
+			w.Write([]byte(playlist))
+			return
+		}
+
+		var seq int
+		if _, err := fmt.Sscanf(r.URL.Path, "/live/seg%d.ts", &seq); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(liveSegment(seq))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func liveSegment(seq int) []byte {
+	packet := append([]byte{0x47, 0x01, 0x00, 0x10, byte(seq)}, bytes.Repeat([]byte{0xff}, 183)...)
+	return packet
+}
+
+// recordLive 录制 server 上的直播流，返回按录制顺序排列的段序列号
+func recordLive(t *testing.T, server *httptest.Server, dir string) []int {
+	log := logger.New("fatal")
+	hc := httpClient.NewClient(time.Second, 1, "test", log)
+	fetcher := m3u8.NewFetcher(hc, log)
+	playlistURL := server.URL + "/live/index.m3u8"
+	reload := func(ctx context.Context) (*m3u8.Manifest, error) {
+		return fetcher.FetchManifest(ctx, playlistURL, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	manifest, err := reload(ctx)
+	if err != nil {
+		t.Fatalf("FetchManifest 失败: %v", err)
+	}
+
+	dm := NewDownloadManager(hc, 2, 1, log)
+	dm.SetReporter(progress.NewSilent())
+	if err := dm.DownloadLive(ctx, manifest, dir, reload, 0); err != nil {
+		t.Fatalf("DownloadLive 失败: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("录制未在 #EXT-X-ENDLIST 后结束")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sequences []int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sequences = append(sequences, int(data[4]))
+	}
+	return sequences
+}
+
+// TestDownloadLiveSlidingWindow 测试滑动窗口去重、#EXT-X-ENDLIST 结束录制，以及删除上次录制留下的段
+func TestDownloadLiveSlidingWindow(t *testing.T) {
+	server := liveServer(t, []string{
+		livePlaylist(0, 3, false),
+		livePlaylist(0, 3, false),
+		livePlaylist(1, 3, false),
+		livePlaylist(3, 3, true),
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"00001.ts", "00009.ts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("stale"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := fmt.Sprint(recordLive(t, server, dir))
+	if want := fmt.Sprint([]int{0, 1, 2, 3, 4, 5}); got != want {
+		t.Errorf("期望录制 %s, 得到 %s", want, got)
+	}
+}
+
+// TestDownloadLiveSequenceReset 测试媒体序列号重置后继续录制新的段
+func TestDownloadLiveSequenceReset(t *testing.T) {
+	server := liveServer(t, []string{
+		livePlaylist(5, 2, false),
+		livePlaylist(0, 2, false),
+		livePlaylist(1, 2, true),
+	})
+
+	got := fmt.Sprint(recordLive(t, server, t.TempDir()))
+	if want := fmt.Sprint([]int{5, 6, 0, 1, 2}); got != want {
+		t.Errorf("期望录制 %s, 得到 %s", want, got)
+	}
+}
+
+// TestDownloadLiveKeepsOtherFiles 测试目录中有不是录制产生的 TS 文件时拒绝录制且不删除文件
+func TestDownloadLiveKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"00001.ts", "holiday.ts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := logger.New("fatal")
+	dm := NewDownloadManager(httpClient.NewClient(time.Second, 1, "test", log), 2, 1, log)
+	dm.SetReporter(progress.NewSilent())
+	manifest := &m3u8.Manifest{EndList: true}
+	err := dm.DownloadLive(context.Background(), manifest, dir, nil, 0)
+	if !errors.IsCode(err, errors.InvalidConfig) {
+		t.Errorf("期望 %s 错误, 得到 %v", errors.InvalidConfig, err)
+	}
+
+	for _, name := range []string{"00001.ts", "holiday.ts"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s 不应被删除: %v", name, err)
+		}
+	}
+}
@@ -1,30 +1,22 @@
 package core
 
 import (
-	"fmt"
-	"math"
+	"context"
+	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"m3u8-downloader/internal/errors"
 	httpClient "m3u8-downloader/internal/http"
 	"m3u8-downloader/internal/logger"
 	"m3u8-downloader/internal/m3u8"
-	"m3u8-downloader/internal/theme"
+	"m3u8-downloader/internal/metrics"
+	"m3u8-downloader/internal/progress"
 	"m3u8-downloader/internal/util"
 )
 
-// DownloadStats 下载统计信息
-type DownloadStats struct {
-	TotalCount     int64
-	DownloadCount  int64
-	SkippedCount   int64
-	FailedCount    int64
-	StartTime      time.Time
-	LastUpdateTime time.Time
-}
-
 // DownloadManager 下载管理器
 type DownloadManager struct {
 	httpClient     httpClient.Client
@@ -33,11 +25,22 @@ type DownloadManager struct {
 	tsNameTemplate string
 	logger         logger.Logger
 	stats          *DownloadStats
-	// progressActive indicates whether the progress line should be redrawn.
-	// 1 = active, 0 = stopped.
-	progressActive int32
+	// headers 下载 TS 段时附加的请求头
+	headers map[string]string
+	// state 可恢复的任务状态，nil 时按文件是否存在判断段是否已下载
+	state *JobState
+	// reporter 接收下载进度事件
+	reporter progress.Reporter
+	// metrics 运行指标，nil 时不记录
+	metrics *metrics.Metrics
 }
 
+// errEmptySegment 服务器返回了空的段数据
+var errEmptySegment = errors.New(errors.DownloadFailed, "段数据为空", nil)
+
+// errMissingKey 加密段的密钥数据为空
+var errMissingKey = errors.New(errors.DownloadFailed, "加密密钥为空", nil)
+
 // NewDownloadManager 创建新的下载管理器
 func NewDownloadManager(httpClient httpClient.Client, maxGoroutines, maxRetries int, lg logger.Logger) *DownloadManager {
 	dm := &DownloadManager{
@@ -47,20 +50,37 @@ func NewDownloadManager(httpClient httpClient.Client, maxGoroutines, maxRetries
 		tsNameTemplate: "%05d.ts",
 		logger:         lg,
 		stats:          &DownloadStats{},
+		reporter:       progress.NewBar(),
 	}
 
-	// Register progress redraw so log messages won't leave the progress broken
-	// on the terminal. The logger package will call this after printing logs.
-	logger.RegisterProgressRedraw(func() { dm.displayProgress() })
+	return dm
+}
 
-	// enable progress redraw
-	atomic.StoreInt32(&dm.progressActive, 1)
+// SetHeaders 设置下载 TS 段时附加的请求头
+func (dm *DownloadManager) SetHeaders(headers map[string]string) {
+	dm.headers = headers
+}
 
-	return dm
+// SetReporter 设置进度报告器，默认使用终端进度条
+func (dm *DownloadManager) SetReporter(reporter progress.Reporter) {
+	dm.reporter = reporter
+}
+
+// SetMetrics 设置记录解密失败次数的指标，nil 表示不记录
+func (dm *DownloadManager) SetMetrics(m *metrics.Metrics) {
+	dm.metrics = m
+}
+
+// SetState 设置任务状态，用于断点续传
+func (dm *DownloadManager) SetState(state *JobState) {
+	dm.state = state
 }
 
 // Download 下载所有 TS 段
-func (dm *DownloadManager) Download(manifest *m3u8.Manifest, downloadDir string) error {
+//
+// ctx 取消后不再启动新的段，进行中的请求被中止并丢弃 (不计为失败)，
+// 已写入的段保持完成，保存任务状态后返回 ctx.Err()。
+func (dm *DownloadManager) Download(ctx context.Context, manifest *m3u8.Manifest, downloadDir string) error {
 	// 确保目录存在
 	err := util.EnsureDir(downloadDir)
 	if err != nil {
@@ -68,11 +88,10 @@ func (dm *DownloadManager) Download(manifest *m3u8.Manifest, downloadDir string)
 	}
 
 	segments := manifest.Segments
-	dm.stats.TotalCount = int64(len(segments))
-	dm.stats.DownloadCount = 0
-	dm.stats.SkippedCount = 0
-	dm.stats.FailedCount = 0
-	dm.stats.StartTime = time.Now()
+	dm.beginDownload(downloadDir)
+	for _, segment := range segments {
+		dm.stats.addSegment(segment.Duration)
+	}
 
 	dm.logger.Info("开始下载 %d 个 TS 文件到 %s", len(segments), downloadDir)
 
@@ -81,60 +100,130 @@ func (dm *DownloadManager) Download(manifest *m3u8.Manifest, downloadDir string)
 	var wg sync.WaitGroup
 
 	for i, segment := range segments {
-		wg.Add(1)
-		limiter <- struct{}{} // 获取许可
-
-		go func(index int, seg *m3u8.TsSegment) {
-			defer func() {
-				wg.Done()
-				<-limiter // 释放许可
-			}()
-
-			dm.downloadSingleSegment(index, seg, downloadDir, manifest.Key)
-			dm.displayProgress()
-		}(i, segment)
+		if !dm.startSegment(ctx, &wg, limiter, i, segment, downloadDir) {
+			break
+		}
 	}
 
 	wg.Wait()
-	// stop progress redraw and clear the line so subsequent operations (merge)
-	// won't have the progress bar print over log output.
-	atomic.StoreInt32(&dm.progressActive, 0)
-	// unregister redraw callback
-	logger.RegisterProgressRedraw(nil)
-	// clear the progress line
-	fmt.Print("\r\033[K")
-	fmt.Println()
+	dm.finishDownload()
+
+	if dm.state != nil {
+		if err := dm.state.Save(); err != nil {
+			dm.logger.Warn("保存任务状态失败: %v", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		dm.logger.Warn("下载已取消，未完成的段将在续传时重新下载")
+	}
+	return ctx.Err()
+}
+
+// beginDownload 清理上次中断残留的 .part 文件，重置统计信息并通知进度报告器，
+// 段由调用方通过 stats.addSegment 计入
+func (dm *DownloadManager) beginDownload(downloadDir string) {
+	if removed, err := util.RemovePartFiles(downloadDir); err != nil {
+		dm.logger.Warn("清理临时文件失败: %v", err)
+	} else if removed > 0 {
+		dm.logger.Debug("已清理 %d 个未完成的 .part 文件", removed)
+	}
+
+	dm.stats.reset()
+	dm.report(progress.DownloadStarted, -1, nil, 0, nil)
+}
+
+// startSegment 在限制器允许时启动一个下载 goroutine，等待期间 ctx 被取消时返回 false
+func (dm *DownloadManager) startSegment(ctx context.Context, wg *sync.WaitGroup, limiter chan struct{}, index int, segment *m3u8.TsSegment, downloadDir string) bool {
+	if !acquire(ctx, limiter) {
+		return false
+	}
+	dm.runSegment(ctx, wg, limiter, index, segment, downloadDir)
+	return true
+}
+
+// acquire 获取一个下载许可，等待期间 ctx 被取消时返回 false
+func acquire(ctx context.Context, limiter chan struct{}) bool {
+	select {
+	case limiter <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	if ctx.Err() != nil {
+		<-limiter
+		return false
+	}
+	return true
+}
+
+// runSegment 在已获取的许可下启动下载 goroutine，结束时释放许可
+func (dm *DownloadManager) runSegment(ctx context.Context, wg *sync.WaitGroup, limiter chan struct{}, index int, segment *m3u8.TsSegment, downloadDir string) {
+	wg.Add(1)
+	go func(index int, seg *m3u8.TsSegment) {
+		defer func() {
+			wg.Done()
+			<-limiter // 释放许可
+		}()
+
+		dm.downloadSingleSegment(ctx, index, seg, downloadDir)
+	}(index, segment)
+}
+
+// finishDownload 通知进度报告器下载结束并输出下载结果
+func (dm *DownloadManager) finishDownload() {
+	dm.report(progress.DownloadFinished, -1, nil, 0, nil)
 
 	dm.logger.Info("下载完成: 成功 %d, 跳过 %d, 失败 %d",
 		atomic.LoadInt64(&dm.stats.DownloadCount),
 		atomic.LoadInt64(&dm.stats.SkippedCount),
 		atomic.LoadInt64(&dm.stats.FailedCount),
 	)
-
-	return nil
 }
 
-func (dm *DownloadManager) downloadSingleSegment(index int, segment *m3u8.TsSegment, downloadDir string, key *m3u8.EncryptionKey) {
+// downloadSingleSegment 下载、解密并写入一个段
+//
+// ctx 取消时中止请求并直接返回，该段保持未完成，不计为失败。
+func (dm *DownloadManager) downloadSingleSegment(ctx context.Context, index int, segment *m3u8.TsSegment, downloadDir string) {
+	key := segment.Key
 	filePath := filepath.Join(downloadDir, segment.Name)
 
-	// 检查文件是否已存在
-	exists, _ := util.PathExists(filePath)
-	if exists {
-		atomic.AddInt64(&dm.stats.SkippedCount, 1)
+	// 检查段是否已下载: 有任务状态时以状态和校验和为准
+	if dm.state != nil {
+		if dm.state.IsDone(segment.Name) {
+			dm.markSkipped(index, segment, filePath)
+			return
+		}
+	} else if exists, _ := util.PathExists(filePath); exists {
+		dm.markSkipped(index, segment, filePath)
+		return
+	}
+
+	dm.report(progress.SegmentStarted, index, segment, 0, nil)
+
+	// 没有密钥数据的加密段无法解密，不写入未解密的数据
+	if key != nil && len(key.Data) == 0 {
+		dm.logger.Error("段 %d 缺少加密密钥: %s", index, key.URL)
+		dm.markFailed(index, segment, errMissingKey)
 		return
 	}
 
 	// 重试下载
 	for attempt := 1; attempt <= dm.maxRetries; attempt++ {
-		data, err := dm.httpClient.Get(segment.URL)
+		data, err := dm.httpClient.GetWithHeaders(ctx, segment.URL, dm.headers)
+		if err != nil && ctx.Err() != nil {
+			// 已取消: 丢弃该段，续传时重新下载
+			return
+		}
 		if err != nil {
 			if attempt < dm.maxRetries {
 				dm.logger.Warn("下载段 %d 失败，重试 (%d/%d): %v", index, attempt, dm.maxRetries, err)
-				time.Sleep(time.Duration(attempt-1) * time.Second)
+				if !waitRetry(ctx, attempt) {
+					return
+				}
 				continue
 			}
 			dm.logger.Error("下载段 %d 失败: %v", index, err)
-			atomic.AddInt64(&dm.stats.FailedCount, 1)
+			dm.markFailed(index, segment, err)
 			return
 		}
 
@@ -142,25 +231,30 @@ func (dm *DownloadManager) downloadSingleSegment(index int, segment *m3u8.TsSegm
 		if len(data) == 0 {
 			if attempt < dm.maxRetries {
 				dm.logger.Warn("段 %d 数据为空，重试 (%d/%d)", index, attempt, dm.maxRetries)
-				time.Sleep(time.Duration(attempt-1) * time.Second)
+				if !waitRetry(ctx, attempt) {
+					return
+				}
 				continue
 			}
 			dm.logger.Error("段 %d 数据为空", index)
-			atomic.AddInt64(&dm.stats.FailedCount, 1)
+			dm.markFailed(index, segment, errEmptySegment)
 			return
 		}
 
 		// 解密（如果需要）
-		if key != nil && len(key.Data) > 0 {
-			decrypted, err := util.AesDecrypt(data, key.Data)
+		if key != nil {
+			decrypted, err := util.AesDecrypt(data, key.Data, segment.IV())
 			if err != nil {
+				dm.metrics.DecryptFailed()
 				if attempt < dm.maxRetries {
 					dm.logger.Warn("解密段 %d 失败，重试 (%d/%d): %v", index, attempt, dm.maxRetries, err)
-					time.Sleep(time.Duration(attempt-1) * time.Second)
+					if !waitRetry(ctx, attempt) {
+						return
+					}
 					continue
 				}
 				dm.logger.Error("解密段 %d 失败: %v", index, err)
-				atomic.AddInt64(&dm.stats.FailedCount, 1)
+				dm.markFailed(index, segment, err)
 				return
 			}
 			data = decrypted
@@ -169,91 +263,96 @@ func (dm *DownloadManager) downloadSingleSegment(index int, segment *m3u8.TsSegm
 		// 移除 TS padding
 		data = util.RemoveTSPadding(data)
 
-		// 写入文件
-		err = util.WriteFile(filePath, data)
+		// 检查同步字节，截断或错误的响应不写入磁盘
+		if err := util.ValidateTS(data); err != nil {
+			if attempt < dm.maxRetries {
+				dm.logger.Warn("段 %d 数据无效，重试 (%d/%d): %v", index, attempt, dm.maxRetries, err)
+				if !waitRetry(ctx, attempt) {
+					return
+				}
+				continue
+			}
+			dm.logger.Error("段 %d 数据无效: %v", index, err)
+			dm.markFailed(index, segment, err)
+			return
+		}
+
+		// 写入 .part 文件，校验后重命名，中断时不会留下不完整的段
+		err = util.WriteFileAtomic(filePath, data)
 		if err != nil {
 			dm.logger.Error("写入文件 %s 失败: %v", filePath, err)
-			atomic.AddInt64(&dm.stats.FailedCount, 1)
+			dm.markFailed(index, segment, err)
 			return
 		}
 
+		if dm.state != nil {
+			if err := dm.state.MarkDone(segment.Name, data); err != nil {
+				dm.logger.Warn("保存任务状态失败: %v", err)
+			}
+		}
+
+		dm.stats.segmentDone(segment.Duration, int64(len(data)), true)
 		atomic.AddInt64(&dm.stats.DownloadCount, 1)
+		dm.report(progress.SegmentSucceeded, index, segment, int64(len(data)), nil)
 		return
 	}
 }
 
-func (dm *DownloadManager) displayProgress() {
-	// if progress redraw was turned off, don't print anything
-	if atomic.LoadInt32(&dm.progressActive) == 0 {
-		return
-	}
-	downloadCount := atomic.LoadInt64(&dm.stats.DownloadCount)
-	total := dm.stats.TotalCount
+// waitRetry 第 attempt 次失败后等待重试，ctx 取消时返回 false
+func waitRetry(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(time.Duration(attempt-1) * time.Second)
+	defer timer.Stop()
 
-	if total == 0 {
-		return
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
+}
 
-	progress := float32(downloadCount) / float32(total)
-	elapsed := time.Since(dm.stats.StartTime).Seconds()
-
-	speed := float64(downloadCount) / elapsed
-	remainCount := float64(total) - float64(downloadCount)
-	eta := remainCount / speed
-
-	// progress bar rendering — use shared theme colors
-	// colors are provided by internal/theme
-
-	progressWidth := 36
-	pos := int(progress * float32(progressWidth))
-
-	// format ETA into hh:mm:ss or mm:ss
-	etaStr := "--:--"
-	if !math.IsInf(eta, 0) && !math.IsNaN(eta) {
-		d := time.Duration(eta) * time.Second
-		h := int(d.Hours())
-		m := int(d.Minutes()) % 60
-		s := int(d.Seconds()) % 60
-		if h > 0 {
-			etaStr = fmt.Sprintf("%02dh%02dm%02ds", h, m, s)
-		} else {
-			etaStr = fmt.Sprintf("%02dm%02ds", m, s)
-		}
+// markSkipped 把已存在的段计入进度，大小按磁盘上的文件计算
+func (dm *DownloadManager) markSkipped(index int, segment *m3u8.TsSegment, filePath string) {
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
 	}
+	dm.stats.segmentDone(segment.Duration, size, false)
+	atomic.AddInt64(&dm.stats.SkippedCount, 1)
+	dm.report(progress.SegmentSkipped, index, segment, size, nil)
+}
 
-	// spinner
-	sp := []string{"⣽", "⣾", "⣻", "⣷", "⣯", "⣟"}
-	spinner := sp[int(time.Now().UnixNano()/1e8)%len(sp)]
-
-	// render bar with colors using theme
-	filled := ""
-	if pos > 0 {
-		filled = theme.Green + repeatStr("━", pos) + theme.Reset
+func (dm *DownloadManager) markFailed(index int, segment *m3u8.TsSegment, cause error) {
+	atomic.AddInt64(&dm.stats.FailedCount, 1)
+	if dm.state != nil {
+		if err := dm.state.MarkFailed(segment.Name); err != nil {
+			dm.logger.Warn("保存任务状态失败: %v", err)
+		}
 	}
-	empty := theme.Surface1 + repeatStr(" ", progressWidth-pos) + theme.Reset
-
-	// assemble and print
-	fmt.Printf("\r%s %s%s %s%d/%d %6.2f%% %s%.2f files/s ETA:%s %s",
-		theme.Lavender+"Vid Kbps"+theme.Reset,
-		filled,
-		empty,
-		theme.Text,
-		downloadCount,
-		total,
-		progress*100,
-		theme.Text,
-		speed,
-		etaStr,
-		spinner,
-	)
+	dm.report(progress.SegmentFailed, index, segment, 0, cause)
 }
 
-func repeatStr(s string, count int) string {
-	result := ""
-	for i := 0; i < count; i++ {
-		result += s
+// report 向进度报告器发送事件，segment 为 nil 时不附带段信息
+func (dm *DownloadManager) report(eventType progress.EventType, index int, segment *m3u8.TsSegment, bytes int64, cause error) {
+	snapshot := dm.stats.Snapshot()
+	event := progress.Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		Progress: &snapshot,
+	}
+	if segment != nil {
+		event.Segment = &progress.Segment{
+			Index:    index,
+			Name:     segment.Name,
+			URL:      segment.URL,
+			Duration: segment.Duration,
+			Bytes:    bytes,
+		}
+	}
+	if cause != nil {
+		event.Error = cause.Error()
 	}
-	return result
+	dm.reporter.Report(event)
 }
 
 // GetStats 获取下载统计信息
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/progress"
+)
+
+// cancelClient 第一个段正常返回，第二个段在请求中取消下载并阻塞到 ctx 结束
+type cancelClient struct {
+	cancel context.CancelFunc
+	packet []byte
+}
+
+func (c *cancelClient) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.GetWithHeaders(ctx, url, nil)
+}
+
+func (c *cancelClient) GetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	if strings.HasSuffix(url, "/1.ts") {
+		return c.packet, nil
+	}
+	c.cancel()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *cancelClient) GetWithCookie(ctx context.Context, url string, cookie string) ([]byte, error) {
+	return c.GetWithHeaders(ctx, url, nil)
+}
+
+// mapClient 按 URL 返回固定的响应
+type mapClient map[string][]byte
+
+func (c mapClient) Get(ctx context.Context, url string) ([]byte, error) {
+	return c[url], nil
+}
+
+func (c mapClient) GetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	return c[url], nil
+}
+
+func (c mapClient) GetWithCookie(ctx context.Context, url string, cookie string) ([]byte, error) {
+	return c[url], nil
+}
+
+// TestDownloadPartFiles 测试启动时清理残留的 .part 文件，无效数据不会写入最终路径
+func TestDownloadPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &m3u8.Manifest{
+		Segments: []*m3u8.TsSegment{
+			{Name: "00001.ts", URL: "https://example.com/1.ts"},
+			{Name: "00002.ts", URL: "https://example.com/2.ts"},
+		},
+	}
+
+	stale := filepath.Join(dir, "00002.ts.part")
+	if err := os.WriteFile(stale, []byte{0x47, 1}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	client := mapClient{
+		"https://example.com/1.ts": append([]byte{0x47}, bytes.Repeat([]byte{0xff}, 187)...),
+		"https://example.com/2.ts": bytes.Repeat([]byte{0x00}, 188),
+	}
+	dm := NewDownloadManager(client, 2, 1, logger.New("error"))
+	dm.SetReporter(progress.NewSilent())
+
+	if err := dm.Download(context.Background(), manifest, dir); err != nil {
+		t.Fatalf("Download 失败: %v", err)
+	}
+
+	if stats := dm.GetStats(); stats.DownloadCount != 1 || stats.FailedCount != 1 {
+		t.Errorf("期望成功 1 失败 1, 得到 %d/%d", stats.DownloadCount, stats.FailedCount)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00001.ts")); err != nil {
+		t.Errorf("有效的段应写入最终路径: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00002.ts")); !os.IsNotExist(err) {
+		t.Errorf("无效的段不应写入最终路径: %v", err)
+	}
+
+	parts, _ := filepath.Glob(filepath.Join(dir, "*.part"))
+	if len(parts) != 0 {
+		t.Errorf("不应残留 .part 文件: %v", parts)
+	}
+}
+
+// TestDownloadCanceled 测试取消后不再调度新段，进行中的段被丢弃且不计为失败
+func TestDownloadCanceled(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &m3u8.Manifest{
+		Segments: []*m3u8.TsSegment{
+			{Name: "00001.ts", URL: "https://example.com/1.ts", Duration: 4},
+			{Name: "00002.ts", URL: "https://example.com/2.ts", Duration: 4},
+			{Name: "00003.ts", URL: "https://example.com/3.ts", Duration: 4},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	packet := append([]byte{0x47}, bytes.Repeat([]byte{0xff}, 187)...)
+	dm := NewDownloadManager(&cancelClient{cancel: cancel, packet: packet}, 1, 3, logger.New("error"))
+	dm.SetReporter(progress.NewSilent())
+	state := NewJobState(dir, "https://example.com/index.m3u8", "movie", config.DefaultConfig(), manifest)
+	dm.SetState(state)
+
+	err := dm.Download(ctx, manifest, dir)
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("期望 context.Canceled, 得到 %v", err)
+	}
+
+	stats := dm.GetStats()
+	if stats.DownloadCount != 1 || stats.FailedCount != 0 {
+		t.Errorf("期望成功 1 失败 0, 得到 %d/%d", stats.DownloadCount, stats.FailedCount)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00002.ts")); !os.IsNotExist(err) {
+		t.Errorf("被取消的段不应写入文件: %v", err)
+	}
+
+	loaded, err := LoadJobState(dir)
+	if err != nil {
+		t.Fatalf("LoadJobState 失败: %v", err)
+	}
+	if done, remaining := loaded.Counts(); done != 1 || remaining != 2 {
+		t.Errorf("期望 1 完成 2 剩余, 得到 %d/%d", done, remaining)
+	}
+}
+
+// TestDownloadMissingKey 测试缺少密钥数据的加密段计为失败，不写入未解密的数据
+func TestDownloadMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &m3u8.Manifest{
+		Segments: []*m3u8.TsSegment{
+			{Name: "00001.ts", URL: "https://example.com/1.ts", Key: &m3u8.EncryptionKey{Method: m3u8.MethodAES128, URL: "https://example.com/key"}},
+		},
+	}
+
+	client := mapClient{"https://example.com/1.ts": append([]byte{0x47}, bytes.Repeat([]byte{0xff}, 187)...)}
+	dm := NewDownloadManager(client, 1, 3, logger.New("fatal"))
+	dm.SetReporter(progress.NewSilent())
+
+	if err := dm.Download(context.Background(), manifest, dir); err != nil {
+		t.Fatalf("Download 失败: %v", err)
+	}
+	if stats := dm.GetStats(); stats.DownloadCount != 0 || stats.FailedCount != 1 {
+		t.Errorf("期望成功 0 失败 1, 得到 %d/%d", stats.DownloadCount, stats.FailedCount)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00001.ts")); !os.IsNotExist(err) {
+		t.Errorf("未解密的段不应写入文件: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/logger"
+)
+
+// TestNewMergerAutoFallback 测试 auto 模式找不到 FFmpeg 时先尝试纯 Go MP4 封装，失败后拼接为 TS
+func TestNewMergerAutoFallback(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.FFmpeg.Path = filepath.Join(t.TempDir(), "no-ffmpeg")
+
+	merger, name, err := NewMerger(cfg, logger.New("fatal"))
+	if err != nil {
+		t.Fatalf("NewMerger 失败: %v", err)
+	}
+	if name != "MP4 封装" {
+		t.Errorf("期望使用 MP4 封装, 得到 %s", name)
+	}
+
+	// 没有 PAT/PMT 的段无法封装为 MP4，应退回 TS 拼接
+	dir := t.TempDir()
+	packet := append([]byte{0x47, 0x01, 0x00, 0x10}, bytes.Repeat([]byte{0xff}, 184)...)
+	if err := os.WriteFile(filepath.Join(dir, "00001.ts"), packet, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := merger.Merge(dir, filepath.Join(t.TempDir(), "movie.mp4"))
+	if err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	if filepath.Ext(output) != ".ts" {
+		t.Errorf("期望退回 TS 拼接, 得到 %s", output)
+	}
+
+	cfg.FFmpeg.Merger = config.MergerFFmpeg
+	if _, _, err := NewMerger(cfg, logger.New("fatal")); err == nil {
+		t.Error("ffmpeg 模式找不到 FFmpeg 时应失败")
+	}
+}
+
+// TestNewMergerFFmpegDisabled 测试 ffmpeg.enabled 为 false 时 auto 模式不使用 FFmpeg
+func TestNewMergerFFmpegDisabled(t *testing.T) {
+	// true 对任何参数都返回成功，可以冒充可用的 FFmpeg
+	fakeFFmpeg, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("找不到 true 命令")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.FFmpeg.Path = fakeFFmpeg
+	if _, name, err := NewMerger(cfg, logger.New("fatal")); err != nil || name != "FFmpeg" {
+		t.Fatalf("期望使用 FFmpeg, 得到 %s (%v)", name, err)
+	}
+
+	cfg.FFmpeg.Enabled = false
+
+	_, name, err := NewMerger(cfg, logger.New("fatal"))
+	if err != nil {
+		t.Fatalf("NewMerger 失败: %v", err)
+	}
+	if name != "MP4 封装" {
+		t.Errorf("期望使用 MP4 封装, 得到 %s", name)
+	}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/util"
+)
+
+// StateFileName 任务状态文件名，保存在下载目录中
+const StateFileName = "job.json"
+
+// stateVersion 状态文件格式版本
+const stateVersion = 1
+
+// stateSaveInterval 段状态变化时两次写盘的最小间隔
+const stateSaveInterval = time.Second
+
+// 段下载状态
+const (
+	SegmentPending = "pending"
+	SegmentDone    = "done"
+	SegmentFailed  = "failed"
+)
+
+// SegmentState 单个段的下载状态
+type SegmentState struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// JobState 下载任务状态
+//
+// 记录来源地址、解析后的清单、每个段的状态与校验和以及任务配置，
+// 使中断的任务可以不重新获取清单、不依赖原始命令行参数继续下载。
+type JobState struct {
+	Version   int             `json:"version"`
+	SourceURL string          `json:"source_url"`
+	MovieName string          `json:"movie_name"`
+	Config    *config.Config  `json:"config"`
+	Manifest  *m3u8.Manifest  `json:"manifest"`
+	Segments  []*SegmentState `json:"segments"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+
+	mu       sync.Mutex
+	dir      string
+	index    map[string]*SegmentState
+	lastSave time.Time
+}
+
+// NewJobState 为新任务创建状态
+func NewJobState(dir, sourceURL, movieName string, cfg *config.Config, manifest *m3u8.Manifest) *JobState {
+	state := &JobState{
+		Version:   stateVersion,
+		SourceURL: sourceURL,
+		MovieName: movieName,
+		Config:    cfg.WithoutCredentials(),
+		Manifest:  manifest,
+		Segments:  make([]*SegmentState, 0, len(manifest.Segments)),
+		CreatedAt: time.Now(),
+		dir:       dir,
+	}
+
+	for _, seg := range manifest.Segments {
+		state.Segments = append(state.Segments, &SegmentState{
+			Name:   seg.Name,
+			Status: SegmentPending,
+		})
+	}
+	state.buildIndex()
+
+	return state
+}
+
+// LoadJobState 从下载目录读取任务状态
+func LoadJobState(dir string) (*JobState, error) {
+	data, err := util.ReadFile(filepath.Join(dir, StateFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &JobState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.New(errors.FileRead, "任务状态文件格式错误", err)
+	}
+
+	if state.Version != stateVersion {
+		return nil, errors.New(errors.FileRead,
+			fmt.Sprintf("不支持的任务状态版本: %d", state.Version), nil)
+	}
+
+	if state.Manifest == nil || state.Config == nil {
+		return nil, errors.New(errors.FileRead, "任务状态文件不完整", nil)
+	}
+
+	state.dir = dir
+	state.buildIndex()
+
+	return state, nil
+}
+
+func (s *JobState) buildIndex() {
+	s.index = make(map[string]*SegmentState, len(s.Segments))
+	for _, seg := range s.Segments {
+		s.index[seg.Name] = seg
+	}
+}
+
+// IsDone 检查段是否已完整下载: 状态为完成且磁盘上的文件大小与校验和一致
+func (s *JobState) IsDone(name string) bool {
+	s.mu.Lock()
+	seg, ok := s.index[name]
+	if !ok || seg.Status != SegmentDone {
+		s.mu.Unlock()
+		return false
+	}
+	size, sum := seg.Size, seg.SHA256
+	s.mu.Unlock()
+
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() != size {
+		return false
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+
+	return hex.EncodeToString(h.Sum(nil)) == sum
+}
+
+// MarkDone 记录段已下载完成
+func (s *JobState) MarkDone(name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	return s.update(name, func(seg *SegmentState) {
+		seg.Status = SegmentDone
+		seg.Size = int64(len(data))
+		seg.SHA256 = hex.EncodeToString(sum[:])
+	})
+}
+
+// MarkFailed 记录段下载失败
+func (s *JobState) MarkFailed(name string) error {
+	return s.update(name, func(seg *SegmentState) {
+		seg.Status = SegmentFailed
+		seg.Size = 0
+		seg.SHA256 = ""
+	})
+}
+
+func (s *JobState) update(name string, fn func(seg *SegmentState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg, ok := s.index[name]
+	if !ok {
+		seg = &SegmentState{Name: name}
+		s.Segments = append(s.Segments, seg)
+		s.index[name] = seg
+	}
+	fn(seg)
+
+	if time.Since(s.lastSave) < stateSaveInterval {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// Counts 返回已完成与未完成的段数
+func (s *JobState) Counts() (done, remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.Segments {
+		if seg.Status == SegmentDone {
+			done++
+		} else {
+			remaining++
+		}
+	}
+	return done, remaining
+}
+
+// Save 将状态写入下载目录
+func (s *JobState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *JobState) saveLocked() error {
+	s.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.New(errors.FileWrite, "序列化任务状态失败", err)
+	}
+
+	// 先写临时文件再重命名，避免中断时留下半个状态文件；
+	// 清单中包含已获取的解密密钥，只允许所有者读取
+	if err := util.WriteFileAtomicMode(filepath.Join(s.dir, StateFileName), data, 0600); err != nil {
+		return err
+	}
+
+	s.lastSave = s.UpdatedAt
+	return nil
+}
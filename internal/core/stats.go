@@ -0,0 +1,175 @@
+package core
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"m3u8-downloader/internal/progress"
+)
+
+// speedWindow 计算实时下载速度的滑动窗口
+const speedWindow = 5 * time.Second
+
+// DownloadStats 下载统计信息
+//
+// 计数字段与字节字段通过 sync/atomic 更新。时长以毫秒累计，
+// 进度按 #EXTINF 媒体时长加权，播放列表未提供时长时按段数计算。
+type DownloadStats struct {
+	TotalCount     int64
+	DownloadCount  int64
+	SkippedCount   int64
+	FailedCount    int64
+	StartTime      time.Time
+	LastUpdateTime time.Time
+
+	// TotalDuration 所有段的媒体时长之和 (毫秒)
+	TotalDuration int64
+	// DoneDuration 已完成 (下载或跳过) 段的媒体时长之和 (毫秒)
+	DoneDuration int64
+	// DoneBytes 已完成段的字节数，包括跳过的已有段
+	DoneBytes int64
+	// DownloadedBytes 本次运行从网络下载的字节数
+	DownloadedBytes int64
+
+	mu      sync.Mutex
+	samples []byteSample
+}
+
+// byteSample 一次段下载完成时的字节数，用于计算滑动窗口速度
+type byteSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// reset 清空统计信息，开始新的下载
+func (s *DownloadStats) reset() {
+	atomic.StoreInt64(&s.TotalCount, 0)
+	atomic.StoreInt64(&s.DownloadCount, 0)
+	atomic.StoreInt64(&s.SkippedCount, 0)
+	atomic.StoreInt64(&s.FailedCount, 0)
+	atomic.StoreInt64(&s.TotalDuration, 0)
+	atomic.StoreInt64(&s.DoneDuration, 0)
+	atomic.StoreInt64(&s.DoneBytes, 0)
+	atomic.StoreInt64(&s.DownloadedBytes, 0)
+	s.StartTime = time.Now()
+
+	s.mu.Lock()
+	s.samples = nil
+	s.mu.Unlock()
+}
+
+// addSegment 把一个待下载的段计入总量
+func (s *DownloadStats) addSegment(duration float64) {
+	atomic.AddInt64(&s.TotalCount, 1)
+	atomic.AddInt64(&s.TotalDuration, durationMillis(duration))
+}
+
+// segmentDone 记录一个已完成的段，downloaded 为 false 表示跳过的已有段
+func (s *DownloadStats) segmentDone(duration float64, size int64, downloaded bool) {
+	atomic.AddInt64(&s.DoneDuration, durationMillis(duration))
+	atomic.AddInt64(&s.DoneBytes, size)
+	if !downloaded {
+		return
+	}
+
+	atomic.AddInt64(&s.DownloadedBytes, size)
+
+	now := time.Now()
+	s.mu.Lock()
+	s.samples = append(s.samples, byteSample{at: now, bytes: size})
+	s.LastUpdateTime = now
+	s.mu.Unlock()
+}
+
+// Progress 返回 0-1 的完成比例，优先按媒体时长计算
+func (s *DownloadStats) Progress() float64 {
+	if total := atomic.LoadInt64(&s.TotalDuration); total > 0 {
+		return math.Min(float64(atomic.LoadInt64(&s.DoneDuration))/float64(total), 1)
+	}
+	if total := atomic.LoadInt64(&s.TotalCount); total > 0 {
+		done := atomic.LoadInt64(&s.DownloadCount) + atomic.LoadInt64(&s.SkippedCount)
+		return math.Min(float64(done)/float64(total), 1)
+	}
+	return 0
+}
+
+// Speed 返回最近 speedWindow 内的下载速度 (字节/秒)
+func (s *DownloadStats) Speed() float64 {
+	now := time.Now()
+	cutoff := now.Add(-speedWindow)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 丢弃窗口之外的样本
+	i := 0
+	for i < len(s.samples) && s.samples[i].at.Before(cutoff) {
+		i++
+	}
+	s.samples = s.samples[i:]
+
+	var bytes int64
+	for _, sample := range s.samples {
+		bytes += sample.bytes
+	}
+
+	// 刚开始下载时窗口按实际经过的时间计算
+	window := speedWindow
+	if elapsed := now.Sub(s.StartTime); elapsed < window {
+		window = elapsed
+	}
+	if window <= 0 {
+		return 0
+	}
+	return float64(bytes) / window.Seconds()
+}
+
+// EstimatedTotalBytes 按已完成部分的码率估算全部段的总大小，无法估算时返回 0
+func (s *DownloadStats) EstimatedTotalBytes() int64 {
+	doneBytes := atomic.LoadInt64(&s.DoneBytes)
+	ratio := s.Progress()
+	if doneBytes == 0 || ratio == 0 {
+		return 0
+	}
+	return int64(float64(doneBytes) / ratio)
+}
+
+// ETA 按剩余字节与实时速度估算剩余时间，无法估算时 ok 为 false
+func (s *DownloadStats) ETA() (eta time.Duration, ok bool) {
+	total := s.EstimatedTotalBytes()
+	speed := s.Speed()
+	if total == 0 || speed == 0 {
+		return 0, false
+	}
+
+	remaining := total - atomic.LoadInt64(&s.DoneBytes)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return time.Duration(float64(remaining) / speed * float64(time.Second)), true
+}
+
+// Snapshot 返回当前进度，供进度报告器使用
+func (s *DownloadStats) Snapshot() progress.Snapshot {
+	snapshot := progress.Snapshot{
+		Total:          atomic.LoadInt64(&s.TotalCount),
+		Done:           atomic.LoadInt64(&s.DownloadCount) + atomic.LoadInt64(&s.SkippedCount),
+		Skipped:        atomic.LoadInt64(&s.SkippedCount),
+		Failed:         atomic.LoadInt64(&s.FailedCount),
+		Percent:        s.Progress() * 100,
+		Bytes:          atomic.LoadInt64(&s.DoneBytes),
+		EstimatedBytes: s.EstimatedTotalBytes(),
+		Speed:          s.Speed(),
+		ETA:            -1,
+	}
+	if eta, ok := s.ETA(); ok {
+		snapshot.ETA = eta.Seconds()
+	}
+	return snapshot
+}
+
+func durationMillis(seconds float64) int64 {
+	return int64(seconds * 1000)
+}
@@ -0,0 +1,49 @@
+package core
+
+import "testing"
+
+// TestDownloadStatsWeighted 测试进度按 #EXTINF 时长加权并据此估算总大小
+func TestDownloadStatsWeighted(t *testing.T) {
+	stats := &DownloadStats{}
+	stats.reset()
+	stats.addSegment(2)
+	stats.addSegment(2)
+	stats.addSegment(6)
+
+	// 已有的短段被跳过，长段刚下载完
+	stats.segmentDone(2, 1<<20, false)
+	stats.segmentDone(6, 3<<20, true)
+
+	if got := stats.Progress(); got != 0.8 {
+		t.Errorf("期望进度 0.8, 得到 %v", got)
+	}
+	if got := stats.EstimatedTotalBytes(); got != 5<<20 {
+		t.Errorf("期望预计总大小 5MB, 得到 %d", got)
+	}
+	if stats.DownloadedBytes != 3<<20 {
+		t.Errorf("跳过的段不应计入下载字节数, 得到 %d", stats.DownloadedBytes)
+	}
+	if stats.Speed() <= 0 {
+		t.Error("期望实时速度大于 0")
+	}
+	if _, ok := stats.ETA(); !ok {
+		t.Error("期望可以估算剩余时间")
+	}
+}
+
+// TestDownloadStatsCountFallback 测试没有时长信息时按段数计算进度
+func TestDownloadStatsCountFallback(t *testing.T) {
+	stats := &DownloadStats{}
+	stats.reset()
+	for i := 0; i < 4; i++ {
+		stats.addSegment(0)
+	}
+	stats.DownloadCount = 1
+
+	if got := stats.Progress(); got != 0.25 {
+		t.Errorf("期望进度 0.25, 得到 %v", got)
+	}
+	if _, ok := stats.ETA(); ok {
+		t.Error("没有下载字节时不应估算剩余时间")
+	}
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"m3u8-downloader/internal/errors"
+)
+
+// Client 通过 Unix 套接字访问守护进程的客户端
+type Client struct {
+	http *http.Client
+}
+
+// NewClient 创建连接 socketPath 的客户端
+func NewClient(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport, Timeout: 10 * time.Second}}
+}
+
+// Add 加入任务
+func (c *Client) Add(req AddRequest) (Job, error) {
+	var job Job
+	err := c.do(http.MethodPost, "/jobs", req, &job)
+	return job, err
+}
+
+// List 列出所有任务
+func (c *Client) List() ([]Job, error) {
+	var jobs []Job
+	err := c.do(http.MethodGet, "/jobs", nil, &jobs)
+	return jobs, err
+}
+
+// Get 查看任务
+func (c *Client) Get(id int64) (Job, error) {
+	var job Job
+	err := c.do(http.MethodGet, fmt.Sprintf("/jobs/%d", id), nil, &job)
+	return job, err
+}
+
+// Remove 删除任务
+func (c *Client) Remove(id int64) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/jobs/%d", id), nil, nil)
+}
+
+// Pause 暂停任务
+func (c *Client) Pause(id int64) (Job, error) {
+	return c.action(id, "pause", nil)
+}
+
+// Resume 恢复任务
+func (c *Client) Resume(id int64) (Job, error) {
+	return c.action(id, "resume", nil)
+}
+
+// Cancel 取消任务
+func (c *Client) Cancel(id int64) (Job, error) {
+	return c.action(id, "cancel", nil)
+}
+
+// SetPriority 调整任务的优先级
+func (c *Client) SetPriority(id int64, priority int) (Job, error) {
+	return c.action(id, "priority", PriorityRequest{Priority: priority})
+}
+
+func (c *Client) action(id int64, action string, body interface{}) (Job, error) {
+	var job Job
+	err := c.do(http.MethodPost, fmt.Sprintf("/jobs/%d/%s", id, action), body, &job)
+	return job, err
+}
+
+// do 发送请求并解码响应，守护进程返回的错误按错误码还原
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.New(errors.DaemonFailed, "序列化请求失败", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	// 主机名仅用于构造 URL，连接总是走 Unix 套接字
+	req, err := http.NewRequest(method, "http://daemon"+path, reader)
+	if err != nil {
+		return errors.New(errors.DaemonFailed, "创建请求失败", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.New(errors.DaemonFailed, "无法连接守护进程 (是否已运行 m3u8-downloader daemon?)", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code == "" {
+			return errors.New(errors.DaemonFailed, fmt.Sprintf("守护进程返回状态 %d", resp.StatusCode), nil)
+		}
+		return errors.New(e.Code, e.Error, nil)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.New(errors.DaemonFailed, "解析守护进程响应失败", err)
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/core"
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/progress"
+)
+
+// ConfigFunc 返回运行任务时使用的配置，由调用方按地址匹配站点档案
+type ConfigFunc func(url string) (*config.Config, error)
+
+// Daemon 常驻的下载守护进程
+//
+// 按优先级从 Store 中取出排队的任务，最多 maxJobs 个同时运行，所有任务共享
+// core.Batch 的 HTTP 客户端。暂停与取消会中断运行中的任务并保存进度，
+// 恢复后由 Application 的断点续传继续下载。
+type Daemon struct {
+	store       *Store
+	batch       *core.Batch
+	logger      logger.Logger
+	configFor   ConfigFunc
+	maxJobs     int
+	defaultName string
+	reporter    progress.Reporter
+	events      *hub
+
+	mu      sync.Mutex
+	running map[int64]*runningJob
+	wg      sync.WaitGroup
+	wake    chan struct{}
+}
+
+// runningJob 运行中的任务，intent 记录中断后应进入的状态
+type runningJob struct {
+	cancel context.CancelFunc
+	intent Status
+}
+
+// New 创建守护进程，cfg.Download.MaxJobs 控制同时运行的任务数
+func New(store *Store, batch *core.Batch, cfg *config.Config, configFor ConfigFunc, logger logger.Logger) *Daemon {
+	maxJobs := cfg.Download.MaxJobs
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+
+	return &Daemon{
+		store:       store,
+		batch:       batch,
+		logger:      logger,
+		configFor:   configFor,
+		maxJobs:     maxJobs,
+		defaultName: "movie",
+		reporter:    progress.NewSilent(),
+		events:      newHub(),
+		running:     make(map[int64]*runningJob),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// SetDefaultName 设置未指定输出名的任务的前缀，任务命名为 <前缀>_<编号>
+func (d *Daemon) SetDefaultName(name string) {
+	d.defaultName = name
+}
+
+// SetReporter 设置接收所有任务进度事件的报告器，事件的 Job 字段为任务输出名
+func (d *Daemon) SetReporter(reporter progress.Reporter) {
+	d.reporter = reporter
+}
+
+// Run 调度任务直到 ctx 被取消
+//
+// ctx 取消后中断所有运行中的任务并保存进度，它们在下次启动时重新排队。
+func (d *Daemon) Run(ctx context.Context) error {
+	d.logger.Info("[守护] 已启动, 同时运行 %d 个任务", d.maxJobs)
+
+	for {
+		d.schedule(ctx)
+
+		select {
+		case <-ctx.Done():
+			d.logger.Info("[守护] 正在停止, 等待运行中的任务保存进度...")
+			d.mu.Lock()
+			for _, r := range d.running {
+				r.intent = StatusQueued
+				r.cancel()
+			}
+			d.mu.Unlock()
+			d.wg.Wait()
+			return nil
+		case <-d.wake:
+		}
+	}
+}
+
+// Add 校验任务配置后加入队列
+func (d *Daemon) Add(job Job) (Job, error) {
+	if !strings.HasPrefix(job.URL, "http://") && !strings.HasPrefix(job.URL, "https://") {
+		return Job{}, errors.New(errors.InvalidURL, "地址必须以 http 或 https 开头", nil)
+	}
+	if err := validName(job.Name); err != nil {
+		return Job{}, err
+	}
+	if _, err := d.jobConfig(job); err != nil {
+		return Job{}, err
+	}
+
+	// 持有 d.mu 使调度循环在补全输出名之前不会取出该任务
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	added, err := d.store.Add(job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	// 输出名依赖分配的编号
+	if added.Name == "" {
+		added, err = d.store.Update(added.ID, func(j *Job) error {
+			j.Name = fmt.Sprintf("%s_%03d", d.defaultName, j.ID)
+			return nil
+		})
+		if err != nil {
+			return Job{}, err
+		}
+	}
+
+	d.logger.Info("[守护] 任务 %d 已加入队列: %s (%s)", added.ID, added.Name, added.URL)
+	d.changed(added)
+	return added, nil
+}
+
+// List 返回队列中的所有任务
+func (d *Daemon) List() []Job {
+	return d.store.List()
+}
+
+// Get 返回一个任务
+func (d *Daemon) Get(id int64) (Job, error) {
+	return d.store.Get(id)
+}
+
+// Stats 返回任务最近一次的下载统计，任务尚未开始时各项为 0
+func (d *Daemon) Stats(id int64) (progress.Snapshot, error) {
+	job, err := d.store.Get(id)
+	if err != nil {
+		return progress.Snapshot{}, err
+	}
+	if job.Progress == nil {
+		return progress.Snapshot{ETA: -1}, nil
+	}
+	return *job.Progress, nil
+}
+
+// Remove 删除未在运行的任务
+func (d *Daemon) Remove(id int64) error {
+	if err := d.store.Remove(id); err != nil {
+		return err
+	}
+	d.events.publish(Event{Type: EventRemoved, JobID: id})
+	return nil
+}
+
+// Pause 暂停任务: 排队的任务不再被调度，运行中的任务中断并保存进度
+func (d *Daemon) Pause(id int64) (Job, error) {
+	return d.interrupt(id, StatusPaused, StatusQueued)
+}
+
+// Cancel 取消任务: 运行中的任务中断，已下载的段保留在下载目录中
+func (d *Daemon) Cancel(id int64) (Job, error) {
+	return d.interrupt(id, StatusCanceled, StatusQueued, StatusPaused, StatusFailed)
+}
+
+// Resume 把暂停、失败或取消的任务重新排队
+func (d *Daemon) Resume(id int64) (Job, error) {
+	job, err := d.store.Update(id, func(j *Job) error {
+		switch j.Status {
+		case StatusPaused, StatusFailed, StatusCanceled:
+			j.Status = StatusQueued
+			return nil
+		}
+		return invalidState(j, "恢复")
+	})
+	if err == nil {
+		d.changed(job)
+	}
+	return job, err
+}
+
+// SetPriority 调整任务的优先级，对运行中的任务无影响
+func (d *Daemon) SetPriority(id int64, priority int) (Job, error) {
+	job, err := d.store.Update(id, func(j *Job) error {
+		j.Priority = priority
+		return nil
+	})
+	if err == nil {
+		d.changed(job)
+	}
+	return job, err
+}
+
+// SetRateLimit 调整所有任务共享的带宽上限 (字节/秒)，0 表示不限
+func (d *Daemon) SetRateLimit(limitRate, hostLimitRate int64) {
+	d.batch.SetRateLimit(limitRate, hostLimitRate)
+}
+
+// interrupt 把任务置为 status: 运行中的任务被中断，from 中的状态直接修改
+func (d *Daemon) interrupt(id int64, status Status, from ...Status) (Job, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if r, ok := d.running[id]; ok {
+		r.intent = status
+		r.cancel()
+		return d.store.Get(id)
+	}
+
+	job, err := d.store.Update(id, func(j *Job) error {
+		for _, s := range from {
+			if j.Status == s {
+				j.Status = status
+				return nil
+			}
+		}
+		if status == StatusPaused {
+			return invalidState(j, "暂停")
+		}
+		return invalidState(j, "取消")
+	})
+	if err == nil {
+		d.changed(job)
+	}
+	return job, err
+}
+
+// schedule 在有空闲名额时启动排队的任务
+func (d *Daemon) schedule(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for len(d.running) < d.maxJobs && ctx.Err() == nil {
+		job, ok, err := d.store.next()
+		if err != nil {
+			d.logger.Error("[守护] 保存任务队列失败: %v", err)
+		}
+		if !ok {
+			return
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		d.running[job.ID] = &runningJob{cancel: cancel}
+		d.wg.Add(1)
+		d.events.publish(Event{Type: EventJob, JobID: job.ID, Job: &job})
+		go d.run(jobCtx, job)
+	}
+}
+
+// run 运行一个任务并记录结果
+func (d *Daemon) run(ctx context.Context, job Job) {
+	defer d.wg.Done()
+
+	d.logger.Info("[守护] 开始任务 %d: %s (%s)", job.ID, job.Name, job.URL)
+
+	cfg, err := d.jobConfig(job)
+	if err == nil {
+		reporter := &jobReporter{store: d.store, events: d.events, id: job.ID, next: progress.WithJob(d.reporter, job.Name)}
+		err = d.batch.RunJob(ctx, &core.BatchJob{URL: job.URL, Name: job.Name, Config: cfg}, reporter)
+	}
+
+	d.mu.Lock()
+	r := d.running[job.ID]
+	delete(d.running, job.ID)
+	d.mu.Unlock()
+	r.cancel()
+
+	// 中断前已经完成的任务依然记为完成
+	status := StatusDone
+	switch {
+	case err == nil:
+	case r.intent != "":
+		status = r.intent
+	default:
+		status = StatusFailed
+	}
+
+	finished, saveErr := d.store.Update(job.ID, func(j *Job) error {
+		j.Status = status
+		j.Error = ""
+		if status == StatusFailed {
+			j.Error = err.Error()
+		}
+		return nil
+	})
+	if saveErr != nil && !errors.IsCode(saveErr, errors.JobNotFound) {
+		d.logger.Error("[守护] 保存任务队列失败: %v", saveErr)
+	}
+	if saveErr == nil {
+		d.events.publish(Event{Type: EventJob, JobID: job.ID, Job: &finished})
+	}
+
+	switch status {
+	case StatusDone:
+		d.logger.Info("[守护] 任务 %d 完成: %s", job.ID, job.Name)
+	case StatusFailed:
+		d.logger.Error("[守护] 任务 %d 失败: %v", job.ID, err)
+	default:
+		d.logger.Info("[守护] 任务 %d 已%s", job.ID, statusText(status))
+	}
+
+	d.notify()
+}
+
+// jobConfig 按任务地址生成配置并应用任务的覆盖项
+func (d *Daemon) jobConfig(job Job) (*config.Config, error) {
+	cfg, err := d.configFor(job.URL)
+	if err != nil {
+		return nil, err
+	}
+	for key := range job.Overrides {
+		if daemonKey(key) {
+			return nil, config.NewConfigError(fmt.Sprintf("%s 只能在守护进程的配置中设置，任务不能单独设置", key))
+		}
+	}
+	if err := core.ApplyOverrides(cfg, job.Overrides); err != nil {
+		return nil, err
+	}
+
+	// 任务的请求头与配置中的请求头合并
+	if len(job.Headers) > 0 {
+		headers := make(map[string]string, len(cfg.Download.Headers)+len(job.Headers))
+		for k, v := range cfg.Download.Headers {
+			headers[k] = v
+		}
+		for k, v := range job.Headers {
+			headers[k] = v
+		}
+		cfg.Download.Headers = headers
+		cfg.MarkSource("download.headers", config.SourceJob)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// daemonKey 检查配置项是否只能由守护进程的配置决定
+//
+// 任务可能来自 REST 接口，保存路径与 FFmpeg 路径、参数由任务设置时
+// 可以写入任意目录或执行任意程序。
+func daemonKey(key string) bool {
+	return key == "download.save_path" || strings.HasPrefix(key, "ffmpeg.")
+}
+
+// validName 检查任务的输出名，输出名只能是保存路径下的一个文件名
+func validName(name string) error {
+	if name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return errors.New(errors.InvalidConfig, fmt.Sprintf("输出名 %q 不能包含路径分隔符或 ..", name), nil)
+	}
+	return nil
+}
+
+// changed 向订阅者发送任务的新状态并唤醒调度循环
+func (d *Daemon) changed(job Job) {
+	d.events.publish(Event{Type: EventJob, JobID: job.ID, Job: &job})
+	d.notify()
+}
+
+// notify 唤醒调度循环
+func (d *Daemon) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// jobReporter 记录任务的最新进度，把事件发送给订阅者并转发
+type jobReporter struct {
+	store  *Store
+	events *hub
+	id     int64
+	next   progress.Reporter
+}
+
+func (r *jobReporter) Report(event progress.Event) {
+	if event.Progress != nil {
+		r.store.setProgress(r.id, *event.Progress)
+	}
+	r.events.publish(Event{Type: EventProgress, JobID: r.id, Progress: &event})
+	r.next.Report(event)
+}
+
+func invalidState(job *Job, action string) error {
+	return errors.New(errors.JobState, fmt.Sprintf("任务 %d 当前为 %s，无法%s", job.ID, job.Status, action), nil)
+}
+
+func statusText(status Status) string {
+	switch status {
+	case StatusPaused:
+		return "暂停"
+	case StatusCanceled:
+		return "取消"
+	case StatusQueued:
+		return "重新排队"
+	}
+	return string(status)
+}
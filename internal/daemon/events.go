@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"sync"
+
+	"m3u8-downloader/internal/progress"
+)
+
+// 事件类型
+const (
+	// EventJob 任务加入、状态或优先级变化，Job 为变化后的任务
+	EventJob = "job"
+	// EventProgress 任务的下载进度，Progress 为 Application 发出的原始事件
+	EventProgress = "progress"
+	// EventRemoved 任务被删除
+	EventRemoved = "removed"
+)
+
+// Event 推送给订阅者的事件
+type Event struct {
+	Type     string          `json:"type"`
+	JobID    int64           `json:"job_id"`
+	Job      *Job            `json:"job,omitempty"`
+	Progress *progress.Event `json:"progress,omitempty"`
+}
+
+// subscriberBuffer 每个订阅者缓存的事件数，缓存满时丢弃新事件而不阻塞下载
+const subscriberBuffer = 256
+
+// hub 把事件分发给订阅者
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]int64
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[chan Event]int64)}
+}
+
+// subscribe 订阅任务 id 的事件，id 为 0 时订阅所有任务，返回的函数用于取消订阅
+func (h *hub) subscribe(id int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subs[ch] = id
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// publish 发送事件，不等待处理缓慢的订阅者
+func (h *hub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch, id := range h.subs {
+		if id != 0 && id != event.JobID {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/errors"
+)
+
+// AddRequest 加入任务的请求
+type AddRequest struct {
+	URL      string `json:"url"`
+	Name     string `json:"name,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	// Quality 主播放列表的码率选择，与 -quality 相同
+	Quality string `json:"quality,omitempty"`
+	// Headers 附加的请求头，与配置中的请求头合并
+	Headers   map[string]string `json:"headers,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// job 把请求转换为任务，Quality 优先于 Overrides 中的同名项
+func (req AddRequest) job() Job {
+	job := Job{URL: req.URL, Name: req.Name, Priority: req.Priority, Headers: req.Headers, Overrides: req.Overrides}
+	if req.Quality != "" {
+		job.Overrides = make(map[string]string, len(req.Overrides)+1)
+		for k, v := range req.Overrides {
+			job.Overrides[k] = v
+		}
+		job.Overrides["download.quality"] = req.Quality
+	}
+	return job
+}
+
+// PriorityRequest 调整优先级的请求
+type PriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
+// errorResponse 接口返回的错误
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// DefaultSocketPath 返回默认的 Unix 套接字路径: $XDG_RUNTIME_DIR/m3u8-downloader.sock，
+// 未设置时使用临时目录下按用户区分的文件
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "m3u8-downloader.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("m3u8-downloader-%d.sock", os.Getuid()))
+}
+
+// DefaultQueuePath 返回默认的队列文件路径: $XDG_DATA_HOME (默认 ~/.local/share)
+// 下的 m3u8-downloader/queue.json
+func DefaultQueuePath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "m3u8-downloader", "queue.json")
+}
+
+// ListenUnix 在 path 上监听 Unix 套接字，只允许当前用户连接
+//
+// 残留的套接字文件 (上次未正常退出) 会被删除；已有守护进程在监听时返回错误。
+func ListenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, errors.New(errors.DaemonFailed, fmt.Sprintf("守护进程已在运行: %s", path), nil)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.New(errors.DaemonFailed, fmt.Sprintf("监听 %s 失败", path), err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, errors.New(errors.DaemonFailed, "设置套接字权限失败", err)
+	}
+	return listener, nil
+}
+
+// RequireToken 要求请求携带 "Authorization: Bearer <token>"
+//
+// token 为空时只接受 Host 为 localhost 或回环地址的请求，
+// 防止网页通过 DNS 重绑定以同源请求读取接口。
+func RequireToken(handler http.Handler, token string) http.Handler {
+	if token == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !loopbackHost(r.Host) {
+				writeJSON(w, http.StatusForbidden, errorResponse{Code: errors.Unauthorized, Error: "未设置访问令牌时只接受 Host 为本机地址的请求"})
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Code: errors.Unauthorized, Error: "缺少或错误的访问令牌"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost 检查请求的 Host (可带端口) 是否为 localhost 或回环地址
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// rejectBrowser 拒绝浏览器发起的请求，并要求带请求体的 POST 使用 application/json
+//
+// 浏览器的跨站请求总会携带 Origin，而 text/plain 等简单请求不经过 CORS 预检，
+// 否则网页可以向本机的接口提交任务。
+func rejectBrowser(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeJSON(w, http.StatusForbidden, errorResponse{Code: errors.Unauthorized, Error: "不接受浏览器发起的请求"})
+			return
+		}
+		if r.Method == http.MethodPost && r.ContentLength != 0 {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType, errorResponse{Code: errors.InvalidConfig, Error: "请求体必须为 application/json"})
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serve 在 listener 上提供 handler，ctx 取消后关闭，进行中的事件流随之结束
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return errors.New(errors.DaemonFailed, "守护进程接口异常退出", err)
+	}
+	return nil
+}
+
+// Handler 返回守护进程的 HTTP 接口
+//
+//	GET    /jobs                 列出任务
+//	POST   /jobs                 加入任务 (AddRequest)
+//	GET    /jobs/{id}            查看任务
+//	DELETE /jobs/{id}            删除任务
+//	GET    /jobs/{id}/stats      下载统计 (progress.Snapshot)
+//	GET    /jobs/{id}/events     任务的事件流 (Server-Sent Events)
+//	POST   /jobs/{id}/pause      暂停
+//	POST   /jobs/{id}/resume     恢复
+//	POST   /jobs/{id}/cancel     取消
+//	POST   /jobs/{id}/priority   调整优先级 (PriorityRequest)
+//	GET    /events               所有任务的事件流 (Server-Sent Events)
+//
+// 带 Origin 的请求 (浏览器发起) 返回 403，POST 的请求体不是 JSON 时返回 415。
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", d.handleJobs)
+	mux.HandleFunc("/jobs/", d.handleJob)
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		d.streamEvents(w, r, 0)
+	})
+	return rejectBrowser(mux)
+}
+
+func (d *Daemon) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs := d.List()
+		for i := range jobs {
+			jobs[i] = redactJob(jobs[i])
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		var req AddRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errors.New(errors.InvalidConfig, "请求格式错误", err))
+			return
+		}
+		job, err := d.Add(req.job())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, redactJob(job))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (d *Daemon) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var action string
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	var job Job
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		job, err = d.Get(id)
+	case action == "stats" && r.Method == http.MethodGet:
+		stats, err := d.Stats(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+		return
+	case action == "events" && r.Method == http.MethodGet:
+		if _, err := d.Get(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		d.streamEvents(w, r, id)
+		return
+	case action == "" && r.Method == http.MethodDelete:
+		if err = d.Remove(id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case r.Method != http.MethodPost:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	case action == "pause":
+		job, err = d.Pause(id)
+	case action == "resume":
+		job, err = d.Resume(id)
+	case action == "cancel":
+		job, err = d.Cancel(id)
+	case action == "priority":
+		var req PriorityRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			err = errors.New(errors.InvalidConfig, "请求格式错误", err)
+			break
+		}
+		job, err = d.SetPriority(id, req.Priority)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactJob(job))
+}
+
+// keepAliveInterval 事件流空闲时发送注释行的间隔，避免代理断开连接
+const keepAliveInterval = 15 * time.Second
+
+// streamEvents 以 Server-Sent Events 推送任务 id 的事件，id 为 0 时推送所有任务
+//
+// 连接建立后先为每个任务发送一个 job 事件作为当前状态，之后推送变化。
+func (d *Daemon) streamEvents(w http.ResponseWriter, r *http.Request, id int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New(errors.DaemonFailed, "连接不支持事件流", nil))
+		return
+	}
+
+	// 先订阅再读取当前状态，避免遗漏两者之间的变化
+	events, unsubscribe := d.events.subscribe(id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, job := range d.List() {
+		if id == 0 || job.ID == id {
+			job := job
+			writeEvent(w, Event{Type: EventJob, JobID: job.ID, Job: &job})
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			writeEvent(w, event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent 写入一条 "event: <类型>" 与 "data: <JSON>" 组成的消息
+func writeEvent(w io.Writer, event Event) {
+	if event.Job != nil {
+		job := redactJob(*event.Job)
+		event.Job = &job
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// redactJob 返回隐藏请求头的值与凭据覆盖项 (Cookie、代理密码) 的副本，
+// 接口与事件流不返回保存的凭据
+func redactJob(job Job) Job {
+	if len(job.Headers) > 0 {
+		headers := make(map[string]string, len(job.Headers))
+		for name := range job.Headers {
+			headers[name] = "***"
+		}
+		job.Headers = headers
+	}
+	if len(job.Overrides) > 0 {
+		overrides := make(map[string]string, len(job.Overrides))
+		for key, value := range job.Overrides {
+			overrides[key] = config.Redact(key, value)
+		}
+		job.Overrides = overrides
+	}
+	return job
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 按错误码选择状态码，返回 {"code", "error"}
+func writeError(w http.ResponseWriter, err error) {
+	resp := errorResponse{Code: errors.DaemonFailed, Error: err.Error()}
+	switch e := err.(type) {
+	case *errors.Error:
+		// 客户端按错误码重新构造错误，消息中不再重复错误码
+		resp.Code, resp.Error = e.Code, e.Message
+		if e.Err != nil {
+			resp.Error += ": " + e.Err.Error()
+		}
+	case *config.ConfigError:
+		resp.Code = errors.InvalidConfig
+	}
+
+	status := http.StatusInternalServerError
+	switch resp.Code {
+	case errors.JobNotFound:
+		status = http.StatusNotFound
+	case errors.JobState:
+		status = http.StatusConflict
+	case errors.InvalidURL, errors.InvalidConfig:
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
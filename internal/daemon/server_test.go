@@ -0,0 +1,289 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/core"
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/progress"
+)
+
+// newTestDaemon 创建不运行调度循环的守护进程，任务保持排队
+func newTestDaemon(t *testing.T) *Daemon {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatalf("OpenStore 失败: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	log := logger.New("error")
+	batch, err := core.NewBatch(cfg, log)
+	if err != nil {
+		t.Fatalf("NewBatch 失败: %v", err)
+	}
+	configFor := func(string) (*config.Config, error) { return config.DefaultConfig(), nil }
+	return New(store, batch, cfg, configFor, log)
+}
+
+// TestClient 测试客户端通过 Unix 套接字管理队列，调度循环不运行，任务保持排队
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestDaemon(t)
+	d.SetDefaultName("ep")
+
+	socket := filepath.Join(dir, "d.sock")
+	listener, err := ListenUnix(socket)
+	if err != nil {
+		t.Fatalf("ListenUnix 失败: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Serve(ctx, listener, d.Handler())
+
+	if _, err := ListenUnix(socket); !errors.IsCode(err, errors.DaemonFailed) {
+		t.Errorf("重复监听应返回 DAEMON_FAILED, 得到 %v", err)
+	}
+
+	client := NewClient(socket)
+
+	job, err := client.Add(AddRequest{URL: "https://example.com/a.m3u8", Overrides: map[string]string{"download.quality": "720p"}})
+	if err != nil {
+		t.Fatalf("Add 失败: %v", err)
+	}
+	if job.ID != 1 || job.Name != "ep_001" || job.Status != StatusQueued {
+		t.Errorf("加入的任务错误: %+v", job)
+	}
+
+	if _, err := client.Add(AddRequest{URL: "ftp://example.com/a.m3u8"}); !errors.IsCode(err, errors.InvalidURL) {
+		t.Errorf("无效地址应返回 INVALID_URL, 得到 %v", err)
+	}
+	if _, err := client.Add(AddRequest{URL: "https://example.com/a.m3u8", Overrides: map[string]string{"http.proxy": "x"}}); !errors.IsCode(err, errors.InvalidConfig) {
+		t.Errorf("共享配置项应返回 INVALID_CONFIG, 得到 %v", err)
+	}
+
+	if job, err = client.Pause(1); err != nil || job.Status != StatusPaused {
+		t.Errorf("Pause 失败: %+v, %v", job, err)
+	}
+	if _, err = client.Pause(1); !errors.IsCode(err, errors.JobState) {
+		t.Errorf("重复暂停应返回 JOB_STATE, 得到 %v", err)
+	}
+	if job, err = client.SetPriority(1, 7); err != nil || job.Priority != 7 {
+		t.Errorf("SetPriority 失败: %+v, %v", job, err)
+	}
+	if job, err = client.Resume(1); err != nil || job.Status != StatusQueued {
+		t.Errorf("Resume 失败: %+v, %v", job, err)
+	}
+
+	jobs, err := client.List()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("List 失败: %v, %v", jobs, err)
+	}
+
+	if err := client.Remove(1); err != nil {
+		t.Errorf("Remove 失败: %v", err)
+	}
+	if _, err := client.Get(1); !errors.IsCode(err, errors.JobNotFound) {
+		t.Errorf("已删除的任务应返回 JOB_NOT_FOUND, 得到 %v", err)
+	}
+
+	cancel()
+	if _, err := NewClient(filepath.Join(dir, "none.sock")).List(); !errors.IsCode(err, errors.DaemonFailed) {
+		t.Errorf("连接失败应返回 DAEMON_FAILED, 得到 %v", err)
+	}
+}
+
+// TestRESTEvents 测试访问令牌、统计接口与事件流
+func TestRESTEvents(t *testing.T) {
+	d := newTestDaemon(t)
+	server := httptest.NewServer(RequireToken(d.Handler(), "secret"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/jobs")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("缺少令牌应返回 401, 得到 %d", resp.StatusCode)
+	}
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s 失败: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp = do(http.MethodPost, "/jobs", `{"url":"https://example.com/a.m3u8","name":"a","quality":"720p","headers":{"X-Token":"t"},"overrides":{"download.cookie":"sid=secret"}}`)
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || job.Overrides["download.quality"] != "720p" {
+		t.Fatalf("加入任务失败: %d %+v", resp.StatusCode, job)
+	}
+	// 接口不返回保存的凭据，队列中保留原值
+	if job.Headers["X-Token"] != "***" || job.Overrides["download.cookie"] != "***" {
+		t.Errorf("接口应隐藏请求头与 Cookie: %+v", job)
+	}
+	if stored, _ := d.Get(1); stored.Headers["X-Token"] != "t" || stored.Overrides["download.cookie"] != "sid=secret" {
+		t.Errorf("队列中的凭据不应被修改: %+v", stored)
+	}
+
+	resp = do(http.MethodGet, "/jobs/1/stats", "")
+	var stats progress.Snapshot
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || stats.ETA != -1 {
+		t.Errorf("未开始的任务统计错误: %d %+v", resp.StatusCode, stats)
+	}
+
+	stream := do(http.MethodGet, "/jobs/1/events", "")
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type 错误: %s", ct)
+	}
+	reader := bufio.NewReader(stream.Body)
+
+	// 第一条事件为任务的当前状态
+	if event := readEvent(t, reader); event.Type != EventJob || event.Job.Status != StatusQueued || event.Job.Headers["X-Token"] != "***" {
+		t.Errorf("初始事件错误: %+v", event)
+	}
+
+	// 其他任务的事件不会推送到该任务的事件流
+	d.Add(Job{URL: "https://example.com/b.m3u8", Name: "b"})
+	d.Pause(1)
+	if event := readEvent(t, reader); event.JobID != 1 || event.Job.Status != StatusPaused {
+		t.Errorf("暂停事件错误: %+v", event)
+	}
+
+	d.events.publish(Event{Type: EventProgress, JobID: 1, Progress: &progress.Event{Type: progress.SegmentSucceeded}})
+	if event := readEvent(t, reader); event.Type != EventProgress || event.Progress == nil {
+		t.Errorf("进度事件错误: %+v", event)
+	}
+}
+
+// TestRESTRejectsUnsafeJobs 测试拒绝浏览器请求、非 JSON 请求体、越出保存路径的输出名与只能由守护进程设置的配置项
+func TestRESTRejectsUnsafeJobs(t *testing.T) {
+	d := newTestDaemon(t)
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	post := func(body string, header map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/jobs", strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /jobs 失败: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const valid = `{"url":"https://example.com/a.m3u8","name":"a"}`
+	jsonHeader := map[string]string{"Content-Type": "application/json"}
+
+	tests := []struct {
+		name   string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{"跨站表单", valid, map[string]string{"Content-Type": "text/plain", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"浏览器 JSON 请求", valid, map[string]string{"Content-Type": "application/json", "Origin": "http://127.0.0.1:8787"}, http.StatusForbidden},
+		{"text/plain", valid, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"缺少 Content-Type", valid, nil, http.StatusUnsupportedMediaType},
+		{"输出名包含 ..", `{"url":"https://example.com/a.m3u8","name":".."}`, jsonHeader, http.StatusBadRequest},
+		{"输出名包含路径分隔符", `{"url":"https://example.com/a.m3u8","name":"../../home/user"}`, jsonHeader, http.StatusBadRequest},
+		{"设置保存路径", `{"url":"https://example.com/a.m3u8","overrides":{"download.save_path":"/"}}`, jsonHeader, http.StatusBadRequest},
+		{"设置 FFmpeg 路径", `{"url":"https://example.com/a.m3u8","overrides":{"ffmpeg.path":"/bin/sh"}}`, jsonHeader, http.StatusBadRequest},
+		{"有效任务", valid, map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		if got := post(tt.body, tt.header); got != tt.want {
+			t.Errorf("%s: 期望 %d, 得到 %d", tt.name, tt.want, got)
+		}
+	}
+
+	if jobs := d.List(); len(jobs) != 1 {
+		t.Errorf("期望只加入 1 个任务, 得到 %d", len(jobs))
+	}
+}
+
+// TestRESTRequiresLoopbackHost 测试未设置令牌时拒绝 Host 不是本机地址的请求 (DNS 重绑定)
+func TestRESTRequiresLoopbackHost(t *testing.T) {
+	d := newTestDaemon(t)
+	server := httptest.NewServer(RequireToken(d.Handler(), ""))
+	defer server.Close()
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"", http.StatusOK},
+		{"localhost:8787", http.StatusOK},
+		{"[::1]:8787", http.StatusOK},
+		{"evil.example:8787", http.StatusForbidden},
+		{"192.168.1.2", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/jobs", nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /jobs 失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Host %q: 期望 %d, 得到 %d", tt.host, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+// readEvent 读取一条 Server-Sent Events 消息
+func readEvent(t *testing.T, r *bufio.Reader) Event {
+	t.Helper()
+
+	var name string
+	var event Event
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("读取事件流失败: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("解析事件失败: %v", err)
+			}
+		case line == "" && name != "":
+			if name != event.Type {
+				t.Errorf("事件名 %s 与类型 %s 不一致", name, event.Type)
+			}
+			return event
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/progress"
+	"m3u8-downloader/internal/util"
+)
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusPaused   Status = "paused"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// Job 队列中的一个下载任务
+type Job struct {
+	ID   int64  `json:"id"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+	// Priority 数值大的任务先运行，相同优先级按加入顺序
+	Priority int `json:"priority"`
+	// Overrides 该任务单独的配置项，与批量列表中的 key=value 相同
+	Overrides map[string]string `json:"overrides,omitempty"`
+	// Headers 该任务附加的请求头，与配置中的请求头合并
+	Headers map[string]string `json:"headers,omitempty"`
+	Status  Status            `json:"status"`
+	// Error 最近一次失败的原因
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Progress 最近一次进度，仅运行中或运行过的任务
+	Progress *progress.Snapshot `json:"progress,omitempty"`
+}
+
+// Store 持久化的任务队列
+//
+// 所有任务保存在一个 JSON 文件中，每次修改后先写临时文件再重命名，
+// 进程在任意时刻退出都不会损坏队列。
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	nextID int64
+	jobs   []*Job
+}
+
+// storeFile 队列文件的内容
+type storeFile struct {
+	NextID int64  `json:"next_id"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+// OpenStore 打开队列文件，不存在时创建空队列
+//
+// 上次退出时仍在运行的任务重新排队，由 Application 的断点续传继续下载。
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, nextID: 1}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// 队列保存任务的请求头与 Cookie 覆盖项，目录与文件只允许当前用户访问
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, errors.New(errors.DirCreate, "创建目录失败", err)
+		}
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, errors.New(errors.FileRead, "读取任务队列失败", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.New(errors.FileRead, fmt.Sprintf("任务队列文件格式错误: %s", path), err)
+	}
+
+	s.jobs = file.Jobs
+	if file.NextID > s.nextID {
+		s.nextID = file.NextID
+	}
+	for _, job := range s.jobs {
+		if job.Status == StatusRunning {
+			job.Status = StatusQueued
+		}
+		if job.ID >= s.nextID {
+			s.nextID = job.ID + 1
+		}
+	}
+
+	return s, s.save()
+}
+
+// Add 把任务加入队列，返回分配了编号的任务
+func (s *Store) Add(job Job) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job.ID = s.nextID
+	job.Status = StatusQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	s.nextID++
+	s.jobs = append(s.jobs, &job)
+	return job, s.save()
+}
+
+// List 按编号顺序返回所有任务的副本
+func (s *Store) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// Get 返回任务的副本
+func (s *Store) Get(id int64) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.find(id)
+	if job == nil {
+		return Job{}, notFound(id)
+	}
+	return *job, nil
+}
+
+// Update 在锁内修改任务并保存，fn 返回错误时不保存
+func (s *Store) Update(id int64, fn func(job *Job) error) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.find(id)
+	if job == nil {
+		return Job{}, notFound(id)
+	}
+
+	updated := *job
+	if err := fn(&updated); err != nil {
+		return Job{}, err
+	}
+	updated.UpdatedAt = time.Now()
+	*job = updated
+
+	return updated, s.save()
+}
+
+// Remove 从队列中删除任务，运行中的任务不能删除
+func (s *Store) Remove(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, job := range s.jobs {
+		if job.ID != id {
+			continue
+		}
+		if job.Status == StatusRunning {
+			return errors.New(errors.JobState, fmt.Sprintf("任务 %d 正在运行，请先取消", id), nil)
+		}
+		s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+		return s.save()
+	}
+	return notFound(id)
+}
+
+// next 取出优先级最高的排队任务并标记为运行中，没有排队任务时 ok 为 false
+func (s *Store) next() (job Job, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *Job
+	for _, j := range s.jobs {
+		if j.Status != StatusQueued {
+			continue
+		}
+		if best == nil || j.Priority > best.Priority || (j.Priority == best.Priority && j.ID < best.ID) {
+			best = j
+		}
+	}
+	if best == nil {
+		return Job{}, false, nil
+	}
+
+	best.Status = StatusRunning
+	best.Error = ""
+	best.UpdatedAt = time.Now()
+	return *best, true, s.save()
+}
+
+// setProgress 记录任务的最新进度，只更新内存，随下一次状态变化写入文件
+func (s *Store) setProgress(id int64, snapshot progress.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job := s.find(id); job != nil {
+		job.Progress = &snapshot
+	}
+}
+
+// find 按编号查找任务，调用方需持有 s.mu
+func (s *Store) find(id int64) *Job {
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// save 写入队列文件，调用方需持有 s.mu
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(storeFile{NextID: s.nextID, Jobs: s.jobs}, "", "  ")
+	if err != nil {
+		return errors.New(errors.FileWrite, "序列化任务队列失败", err)
+	}
+	return util.WriteFileAtomicMode(s.path, data, 0600)
+}
+
+func notFound(id int64) error {
+	return errors.New(errors.JobNotFound, fmt.Sprintf("任务 %d 不存在", id), nil)
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"m3u8-downloader/internal/errors"
+)
+
+// TestStorePersist 测试队列在重新打开后保留任务与编号，运行中的任务重新排队
+func TestStorePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "queue.json")
+
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore 失败: %v", err)
+	}
+	if _, err := store.Add(Job{URL: "https://example.com/a.m3u8", Name: "a"}); err != nil {
+		t.Fatalf("Add 失败: %v", err)
+	}
+	if _, err := store.Add(Job{URL: "https://example.com/b.m3u8", Name: "b", Overrides: map[string]string{"download.quality": "720p"}}); err != nil {
+		t.Fatalf("Add 失败: %v", err)
+	}
+	if _, ok, err := store.next(); !ok || err != nil {
+		t.Fatalf("next 失败: %v", err)
+	}
+
+	reopened, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	jobs := reopened.List()
+	if len(jobs) != 2 {
+		t.Fatalf("期望 2 个任务, 得到 %d", len(jobs))
+	}
+	if jobs[0].Status != StatusQueued {
+		t.Errorf("运行中的任务应重新排队, 得到 %s", jobs[0].Status)
+	}
+	if jobs[1].Overrides["download.quality"] != "720p" {
+		t.Errorf("覆盖项未保存: %v", jobs[1].Overrides)
+	}
+
+	added, err := reopened.Add(Job{URL: "https://example.com/c.m3u8", Name: "c"})
+	if err != nil {
+		t.Fatalf("Add 失败: %v", err)
+	}
+	if added.ID != 3 {
+		t.Errorf("编号应继续递增, 得到 %d", added.ID)
+	}
+}
+
+// TestStorePermissions 测试队列文件与目录只允许当前用户访问
+func TestStorePermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "queue.json")
+
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore 失败: %v", err)
+	}
+	if _, err := store.Add(Job{URL: "https://example.com/a.m3u8", Name: "a", Headers: map[string]string{"Authorization": "Bearer secret"}}); err != nil {
+		t.Fatalf("Add 失败: %v", err)
+	}
+
+	for p, want := range map[string]os.FileMode{path: 0600, filepath.Dir(path): 0700} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s 期望权限 %o, 得到 %o", p, want, info.Mode().Perm())
+		}
+	}
+}
+
+// TestStoreNext 测试按优先级取任务，相同优先级按加入顺序
+func TestStoreNext(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatalf("OpenStore 失败: %v", err)
+	}
+
+	for _, p := range []int{0, 5, 5, -1} {
+		if _, err := store.Add(Job{URL: "https://example.com/v.m3u8", Priority: p}); err != nil {
+			t.Fatalf("Add 失败: %v", err)
+		}
+	}
+	if _, err := store.Update(1, func(j *Job) error { j.Status = StatusPaused; return nil }); err != nil {
+		t.Fatalf("Update 失败: %v", err)
+	}
+
+	var order []int64
+	for {
+		job, ok, err := store.next()
+		if err != nil {
+			t.Fatalf("next 失败: %v", err)
+		}
+		if !ok {
+			break
+		}
+		order = append(order, job.ID)
+	}
+
+	want := []int64{2, 3, 4}
+	if len(order) != len(want) {
+		t.Fatalf("期望顺序 %v, 得到 %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("期望顺序 %v, 得到 %v", want, order)
+		}
+	}
+}
+
+// TestStoreRemove 测试运行中的任务不能删除
+func TestStoreRemove(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatalf("OpenStore 失败: %v", err)
+	}
+	store.Add(Job{URL: "https://example.com/a.m3u8"})
+	store.Add(Job{URL: "https://example.com/b.m3u8"})
+	store.next()
+
+	if err := store.Remove(1); !errors.IsCode(err, errors.JobState) {
+		t.Errorf("删除运行中的任务应返回 JOB_STATE, 得到 %v", err)
+	}
+	if err := store.Remove(2); err != nil {
+		t.Errorf("删除排队的任务失败: %v", err)
+	}
+	if err := store.Remove(2); !errors.IsCode(err, errors.JobNotFound) {
+		t.Errorf("删除不存在的任务应返回 JOB_NOT_FOUND, 得到 %v", err)
+	}
+}
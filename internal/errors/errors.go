@@ -45,6 +45,11 @@ const (
 	DirCreate      = "DIR_CREATE"
 	InvalidURL     = "INVALID_URL"
 	InvalidConfig  = "INVALID_CONFIG"
+	Canceled       = "CANCELED"
+	JobNotFound    = "JOB_NOT_FOUND"
+	JobState       = "JOB_STATE"
+	DaemonFailed   = "DAEMON_FAILED"
+	Unauthorized   = "UNAUTHORIZED"
 )
 
 // IsCode 检查错误是否为特定错误码
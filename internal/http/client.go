@@ -1,133 +1,394 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
 	"fmt"
+	"io"
 	"net"
+	nethttp "net/http"
+	"sync"
 	"time"
 
 	"m3u8-downloader/internal/errors"
 	"m3u8-downloader/internal/logger"
-
-	"github.com/levigross/grequests"
+	"m3u8-downloader/internal/metrics"
 )
 
 // Client HTTP 客户端接口
+//
+// ctx 取消时正在进行的请求立即中止，不再重试，返回 ctx.Err()。
 type Client interface {
-	Get(url string) ([]byte, error)
-	GetWithHeaders(url string, headers map[string]string) ([]byte, error)
-	GetWithCookie(url string, cookie string) ([]byte, error)
+	Get(ctx context.Context, url string) ([]byte, error)
+	GetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error)
+	GetWithCookie(ctx context.Context, url string, cookie string) ([]byte, error)
 }
 
+// 连接池参数: 下载线程最多 256 个，每个主机保留同样数量的空闲连接以便复用
+const (
+	maxIdleConns        = 512
+	maxIdleConnsPerHost = 256
+	idleConnTimeout     = 90 * time.Second
+	keepAlive           = 30 * time.Second
+)
+
 // HTTPClient HTTP 客户端实现
+//
+// 所有请求共享同一个 net/http.Transport，并发下载时复用 TCP/TLS 连接，
+// 服务器支持时自动使用 HTTP/2。读取响应体时经过全局与按主机的限速器。
 type HTTPClient struct {
-	timeout        time.Duration
-	maxRetries     int
-	userAgent      string
-	insecureVerify bool
-	logger         logger.Logger
+	client     *nethttp.Client
+	transport  *nethttp.Transport
+	timeout    time.Duration
+	maxRetries int
+	userAgent  string
+	logger     logger.Logger
+
+	limiter      *RateLimiter
+	hostMu       sync.Mutex
+	hostRate     int64
+	hostLimiters map[string]*RateLimiter
+
+	metrics *metrics.Metrics
 }
 
-// NewClient 创建新的 HTTP 客户端
-func NewClient(timeout time.Duration, maxRetries int, userAgent string, logger logger.Logger) Client {
+// NewClient 创建新的 HTTP 客户端，maxRetries 为每个请求的最多尝试次数，小于 1 时按 1 处理
+func NewClient(timeout time.Duration, maxRetries int, userAgent string, logger logger.Logger) *HTTPClient {
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
+	}
+
+	transport := &nethttp.Transport{
+		Proxy:                 nethttp.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{},
+	}
+
 	return &HTTPClient{
+		client:     &nethttp.Client{Transport: transport},
+		transport:  transport,
 		timeout:    timeout,
 		maxRetries: maxRetries,
 		userAgent:  userAgent,
 		logger:     logger,
+
+		limiter:      NewRateLimiter(0),
+		hostLimiters: make(map[string]*RateLimiter),
 	}
 }
 
 // SetInsecureVerify 设置是否跳过 SSL 验证
 func (c *HTTPClient) SetInsecureVerify(insecure bool) {
-	c.insecureVerify = insecure
+	tlsConfig := c.transport.TLSClientConfig.Clone()
+	tlsConfig.InsecureSkipVerify = insecure
+	c.transport.TLSClientConfig = tlsConfig
+	c.transport.CloseIdleConnections()
 }
 
-// Get 获取 URL 内容
-func (c *HTTPClient) Get(url string) ([]byte, error) {
-	return c.getWithOptions(url, map[string]string{
+// CloseIdleConnections 关闭连接池中的空闲连接，客户端不再使用时调用
+func (c *HTTPClient) CloseIdleConnections() {
+	c.transport.CloseIdleConnections()
+}
+
+// SetMetrics 设置记录状态码与重试次数的指标，nil 表示不记录
+func (c *HTTPClient) SetMetrics(m *metrics.Metrics) {
+	c.metrics = m
+}
+
+// SetRateLimit 设置所有请求共享的带宽上限 (字节/秒)，0 表示不限，可在下载过程中调整
+func (c *HTTPClient) SetRateLimit(bytesPerSecond int64) {
+	c.limiter.SetRate(bytesPerSecond)
+}
+
+// RateLimit 返回所有请求共享的带宽上限 (字节/秒)
+func (c *HTTPClient) RateLimit() int64 {
+	return c.limiter.Rate()
+}
+
+// SetHostRateLimit 设置每个主机单独的带宽上限 (字节/秒)，0 表示不限，可在下载过程中调整
+func (c *HTTPClient) SetHostRateLimit(bytesPerSecond int64) {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+
+	c.hostRate = bytesPerSecond
+	for _, limiter := range c.hostLimiters {
+		limiter.SetRate(bytesPerSecond)
+	}
+}
+
+// HostRateLimit 返回每个主机单独的带宽上限 (字节/秒)
+func (c *HTTPClient) HostRateLimit() int64 {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+	return c.hostRate
+}
+
+// hostLimiter 返回主机对应的限速器，不存在时按当前的主机上限创建
+func (c *HTTPClient) hostLimiter(host string) *RateLimiter {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+
+	limiter, ok := c.hostLimiters[host]
+	if !ok {
+		limiter = NewRateLimiter(c.hostRate)
+		c.hostLimiters[host] = limiter
+	}
+	return limiter
+}
+
+// defaultHeaders 返回每个请求都会携带的默认请求头
+//
+// 不设置 Accept-Encoding，由 Transport 自动协商 gzip 并透明解压。
+func (c *HTTPClient) defaultHeaders() map[string]string {
+	return map[string]string{
 		"User-Agent":      c.userAgent,
-		"Connection":      "keep-alive",
 		"Accept":          "*/*",
-		"Accept-Encoding": "*",
 		"Accept-Language": "zh-CN,zh;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5",
-	})
+	}
+}
+
+// Get 获取 URL 内容
+func (c *HTTPClient) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.getWithOptions(ctx, url, c.defaultHeaders())
 }
 
 // GetWithHeaders 使用自定义请求头获取 URL 内容
-func (c *HTTPClient) GetWithHeaders(url string, headers map[string]string) ([]byte, error) {
+func (c *HTTPClient) GetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
 	// 合并默认请求头
-	finalHeaders := map[string]string{
-		"User-Agent":      c.userAgent,
-		"Connection":      "keep-alive",
-		"Accept":          "*/*",
-		"Accept-Encoding": "*",
-		"Accept-Language": "zh-CN,zh;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5",
-	}
+	finalHeaders := c.defaultHeaders()
 
 	for k, v := range headers {
 		finalHeaders[k] = v
 	}
 
-	return c.getWithOptions(url, finalHeaders)
+	return c.getWithOptions(ctx, url, finalHeaders)
 }
 
 // GetWithCookie 使用自定义 Cookie 获取 URL 内容
-func (c *HTTPClient) GetWithCookie(url string, cookie string) ([]byte, error) {
+func (c *HTTPClient) GetWithCookie(ctx context.Context, url string, cookie string) ([]byte, error) {
 	headers := map[string]string{}
 	if cookie != "" {
 		headers["Cookie"] = cookie
 	}
-	return c.GetWithHeaders(url, headers)
+	return c.GetWithHeaders(ctx, url, headers)
+}
+
+// GetStream 发起 GET 请求并返回响应体，调用方负责关闭
+//
+// 响应体按需从连接读取，若超过超时时间没有收到新数据则中止请求。
+// 只在建立连接和等待响应头阶段重试。
+func (c *HTTPClient) GetStream(ctx context.Context, url string, headers map[string]string) (io.ReadCloser, error) {
+	finalHeaders := c.defaultHeaders()
+	for k, v := range headers {
+		finalHeaders[k] = v
+	}
+
+	var body io.ReadCloser
+	err := c.retry(ctx, func() error {
+		var err error
+		body, err = c.open(ctx, url, finalHeaders)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *HTTPClient) getWithOptions(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	var data []byte
+	err := c.retry(ctx, func() error {
+		var err error
+		data, err = c.fetch(ctx, url, headers)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-func (c *HTTPClient) getWithOptions(url string, headers map[string]string) ([]byte, error) {
+// retry 执行 attempt 直到成功、遇到不可重试的错误或达到最多尝试次数，
+// 两次尝试之间按次数递增等待
+func (c *HTTPClient) retry(ctx context.Context, attempt func() error) error {
 	var lastErr error
 
-	for attempt := 1; attempt <= c.maxRetries; attempt++ {
-		ro := &grequests.RequestOptions{
-			UserAgent:      c.userAgent,
-			RequestTimeout: c.timeout,
-			Headers:        headers,
+	for n := 1; n <= c.maxRetries; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
 		}
-
-		if c.insecureVerify {
-			ro.InsecureSkipVerify = true
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		resp, err := grequests.Get(url, ro)
-		if err != nil {
-			lastErr = err
-			// c.logger.Warn("HTTP 请求失败 (尝试 %d/%d): %v", attempt, c.maxRetries, err)
+		lastErr = err
+		if !isRetryable(err) || n >= c.maxRetries {
+			break
+		}
 
-			// 如果是网络错误，可能需要重试
-			if isNetworkError(err) && attempt < c.maxRetries {
-				backoffDuration := time.Duration((attempt - 1)) * time.Second
-				time.Sleep(backoffDuration)
-				continue
-			}
+		c.logger.Warn("HTTP 请求失败 (尝试 %d/%d): %v", n, c.maxRetries, err)
+		c.metrics.HTTPRetry()
+		if err := sleepContext(ctx, time.Duration(n-1)*time.Second); err != nil {
+			return err
 		}
+	}
 
-		if resp == nil || !resp.Ok {
-			statusCode := 0
-			if resp != nil {
-				statusCode = resp.StatusCode
-			}
-			lastErr = fmt.Errorf("HTTP 状态异常: %d", statusCode)
-			c.logger.Warn("HTTP 响应失败 (尝试 %d/%d): 状态码 %d", attempt, c.maxRetries, statusCode)
+	return wrapStatusError(lastErr)
+}
 
-			if attempt < c.maxRetries {
-				backoffDuration := time.Duration((attempt - 1)) * time.Second
-				time.Sleep(backoffDuration)
-				continue
+// fetch 执行一次请求并读取完整响应体
+func (c *HTTPClient) fetch(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	body, err := c.open(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, classifyError("读取 HTTP 响应失败", err)
+	}
+
+	return data, nil
+}
+
+// open 执行一次请求，成功时返回带空闲超时与限速的响应体
+func (c *HTTPClient) open(ctx context.Context, url string, headers map[string]string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, errors.New(errors.InvalidURL, "创建 HTTP 请求失败", err)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = classifyError("HTTP 请求失败", err)
+		// 被取消的请求不计入指标
+		if ctx.Err() == nil {
+			if errors.IsCode(err, errors.HTTPTimeout) {
+				c.metrics.HTTPResponse("timeout")
+			} else {
+				c.metrics.HTTPResponse("error")
 			}
 		}
+		cancel()
+		return nil, err
+	}
+	c.metrics.HTTPStatus(resp.StatusCode)
 
-		if resp != nil && resp.Ok {
-			return resp.Bytes(), nil
-		}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// 读掉少量响应体以便连接可以复用
+		io.CopyN(io.Discard, resp.Body, 4096)
+		resp.Body.Close()
+		cancel()
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+
+	body := newIdleTimeoutBody(resp.Body, c.timeout, cancel)
+	body.limit(ctx, c.limiter, c.hostLimiter(req.URL.Host))
+	return body, nil
+}
+
+// sleepContext 等待 d 或 ctx 取消，取消时返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StatusError 表示服务器返回了非 2xx 状态码
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP 状态异常: %d", e.StatusCode)
+}
+
+// Temporary 对 5xx、408 和 429 返回 true，表示可以重试
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 ||
+		e.StatusCode == nethttp.StatusRequestTimeout ||
+		e.StatusCode == nethttp.StatusTooManyRequests
+}
+
+// wrapStatusError 将状态码错误包装为 HTTP_STATUS 应用错误，保留原始 StatusError
+func wrapStatusError(err error) error {
+	if statusErr, ok := err.(*StatusError); ok {
+		return errors.New(errors.HTTPStatus, "HTTP 请求失败", statusErr)
+	}
+	return err
+}
+
+// classifyError 将底层错误包装为超时或请求错误
+func classifyError(message string, err error) error {
+	if appErr, ok := err.(*errors.Error); ok {
+		return appErr
+	}
+	if isTimeout(err) {
+		return errors.New(errors.HTTPTimeout, message+" (超时)", err)
+	}
+	return errors.New(errors.HTTPRequest, message, err)
+}
+
+// isRetryable 检查错误是否值得重试
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if stderrors.As(err, &statusErr) {
+		return statusErr.Temporary()
 	}
 
-	return nil, errors.New(errors.HTTPRequest, "HTTP 请求失败", lastErr)
+	var appErr *errors.Error
+	if stderrors.As(err, &appErr) {
+		return appErr.Code == errors.HTTPTimeout || appErr.Code == errors.HTTPRequest
+	}
+
+	return isNetworkError(err)
+}
+
+// isTimeout 检查是否为超时错误
+func isTimeout(err error) bool {
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if stderrors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
 }
 
 // isNetworkError 检查是否为网络错误
@@ -136,10 +397,66 @@ func isNetworkError(err error) bool {
 		return false
 	}
 
-	// 检查超时错误
-	if netErr, ok := err.(net.Error); ok {
-		return netErr.Timeout()
+	var netErr net.Error
+	return stderrors.As(err, &netErr)
+}
+
+// idleTimeoutBody 在指定时间内没有读到数据时取消请求，避免连接挂起导致下载卡死
+//
+// 设置了限速器时每次读取后等待令牌，等待期间暂停空闲计时。
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	ctx      context.Context
+	limiters []*RateLimiter
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		body:    body,
+		timer:   time.AfterFunc(timeout, cancel),
+		timeout: timeout,
+		cancel:  cancel,
 	}
+}
+
+// limit 设置读取响应体时经过的限速器
+func (b *idleTimeoutBody) limit(ctx context.Context, limiters ...*RateLimiter) {
+	b.ctx = ctx
+	b.limiters = limiters
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if len(b.limiters) > 0 && len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+
+	n, err := b.body.Read(p)
+	if err != nil && err != io.EOF && !b.timer.Stop() {
+		// 计时器已触发: 读取失败是空闲超时导致的
+		return n, errors.New(errors.HTTPTimeout, "读取 HTTP 响应超时", err)
+	}
+	if n > 0 {
+		b.timer.Stop()
+		for _, limiter := range b.limiters {
+			if werr := limiter.WaitN(b.ctx, n); werr != nil {
+				if err == nil {
+					err = werr
+				}
+				break
+			}
+		}
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
 
-	return true
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.body.Close()
+	b.cancel()
+	return err
 }
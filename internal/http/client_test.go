@@ -0,0 +1,191 @@
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	stderrors "errors"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/metrics"
+)
+
+func newTestClient(timeout time.Duration) *HTTPClient {
+	return NewClient(timeout, 3, "test-agent", logger.New("fatal"))
+}
+
+// TestGetRetriesServerErrors 测试 5xx 重试后成功
+func TestGetRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("User-Agent") != "test-agent" {
+			t.Errorf("期望 User-Agent=test-agent, 得到 %s", r.Header.Get("User-Agent"))
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(time.Second)
+	m := metrics.New()
+	client.SetMetrics(m)
+
+	data, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	if string(data) != "ok" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("期望重试一次后得到 ok, 得到 %q (请求 %d 次)", data, calls)
+	}
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	out := recorder.Body.String()
+	for _, want := range []string{
+		`m3u8dl_http_responses_total{code="200"} 1`,
+		`m3u8dl_http_responses_total{code="503"} 1`,
+		"m3u8dl_http_retries_total 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标中缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestGetDoesNotRetryNotFound 测试 4xx 不重试并返回 HTTP_STATUS
+func TestGetDoesNotRetryNotFound(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		atomic.AddInt32(&calls, 1)
+		nethttp.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(time.Second).Get(context.Background(), server.URL)
+	if !errors.IsCode(err, errors.HTTPStatus) {
+		t.Errorf("期望 HTTP_STATUS 错误, 得到 %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("期望只请求 1 次, 实际 %d 次", calls)
+	}
+}
+
+// TestGetTimeout 测试超时错误可以与其他网络错误区分
+func TestGetTimeout(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(50*time.Millisecond).Get(context.Background(), server.URL)
+	if !errors.IsCode(err, errors.HTTPTimeout) {
+		t.Errorf("期望 HTTP_TIMEOUT 错误, 得到 %v", err)
+	}
+}
+
+// TestGetCanceled 测试 ctx 取消后立即返回且不再重试
+func TestGetCanceled(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := newTestClient(10*time.Second).Get(ctx, server.URL)
+	if !stderrors.Is(err, context.Canceled) {
+		t.Errorf("期望 context.Canceled, 得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("取消后应立即返回, 耗时 %v", elapsed)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("取消后不应重试, 实际请求 %d 次", calls)
+	}
+}
+
+// TestGetDecompressesGzip 测试 gzip 响应被透明解压
+func TestGetDecompressesGzip(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("#EXTM3U"))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	data, err := newTestClient(time.Second).Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	if string(data) != "#EXTM3U" {
+		t.Errorf("期望解压后的内容, 得到 %q", data)
+	}
+}
+
+// TestGetZeroRetries 测试最多尝试次数小于 1 时仍请求一次并返回错误
+func TestGetZeroRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(time.Second, 0, "test-agent", logger.New("fatal"))
+	if _, err := client.Get(context.Background(), server.URL); !errors.IsCode(err, errors.HTTPStatus) {
+		t.Errorf("期望 HTTP_STATUS 错误, 得到 %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("期望请求 1 次, 实际 %d 次", calls)
+	}
+}
+
+// TestGetStream 测试流式读取响应体，建立连接阶段的 5xx 会重试
+func TestGetStream(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Test") != "1" {
+			t.Errorf("期望请求头 X-Test=1, 得到 %q", r.Header.Get("X-Test"))
+		}
+		w.Write([]byte("first "))
+		w.(nethttp.Flusher).Flush()
+		w.Write([]byte("second"))
+	}))
+	defer server.Close()
+
+	body, err := newTestClient(time.Second).GetStream(context.Background(), server.URL, map[string]string{"X-Test": "1"})
+	if err != nil {
+		t.Fatalf("GetStream 失败: %v", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("读取响应体失败: %v", err)
+	}
+	if string(data) != "first second" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("期望重试一次后得到完整响应体, 得到 %q (请求 %d 次)", data, calls)
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestSetProxyRoutesRequests 测试请求经过 HTTP 代理并携带认证信息
+func TestSetProxyRoutesRequests(t *testing.T) {
+	proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.WriteHeader(nethttp.StatusProxyAuthRequired)
+			return
+		}
+		w.Write([]byte("via proxy " + r.URL.Host))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	client := newTestClient(time.Second)
+	if err := client.SetProxy(proxyURL.String(), nil); err != nil {
+		t.Fatalf("SetProxy 失败: %v", err)
+	}
+
+	data, err := client.Get(context.Background(), "http://video.example.com/index.m3u8")
+	if err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	if string(data) != "via proxy video.example.com" {
+		t.Errorf("期望请求经过代理, 得到 %q", data)
+	}
+}
+
+// TestProxyRules 测试按主机匹配代理规则
+func TestProxyRules(t *testing.T) {
+	client := newTestClient(time.Second)
+	err := client.SetProxy("http://default:8080", []string{
+		"*.cdn.com=socks5://127.0.0.1:1080",
+		"direct.example.com=direct",
+	})
+	if err != nil {
+		t.Fatalf("SetProxy 失败: %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://a.b.cdn.com/seg.ts", "socks5://127.0.0.1:1080"},
+		{"https://cdn.com/seg.ts", "socks5://127.0.0.1:1080"},
+		{"https://direct.example.com/key", ""},
+		{"https://other.com/index.m3u8", "http://default:8080"},
+	}
+
+	for _, tt := range tests {
+		req, _ := nethttp.NewRequest(nethttp.MethodGet, tt.url, nil)
+		got, err := client.transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("Proxy(%s) 失败: %v", tt.url, err)
+		}
+		gotStr := ""
+		if got != nil {
+			gotStr = got.String()
+		}
+		if gotStr != tt.want {
+			t.Errorf("Proxy(%s) 期望 %q, 得到 %q", tt.url, tt.want, gotStr)
+		}
+	}
+}
+
+// TestSetProxyRejectsInvalid 测试拒绝不支持的代理协议和错误的规则
+func TestSetProxyRejectsInvalid(t *testing.T) {
+	client := newTestClient(time.Second)
+	if err := client.SetProxy("ftp://proxy:21", nil); err == nil {
+		t.Error("期望拒绝 ftp 代理")
+	}
+	if err := client.SetProxy("", []string{"no-equals-sign"}); err == nil {
+		t.Error("期望拒绝格式错误的规则")
+	}
+}
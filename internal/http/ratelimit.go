@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 限速读取参数
+const (
+	// maxLimitedRead 限速时单次读取的最大字节数，使流量更平滑
+	maxLimitedRead = 32 * 1024
+	// maxLimitWait 单次等待的上限，速率在运行时调整后最迟在此时间内生效
+	maxLimitWait = 100 * time.Millisecond
+)
+
+// RateLimiter 令牌桶限速器，可被多个请求并发共享
+//
+// 桶容量为一秒的流量。读取到数据后扣除令牌，令牌不足时允许透支，
+// 之后的读取等待令牌补足，因此单次读取大于桶容量时依然有效。
+// 速率为 0 时不限速，可在运行时通过 SetRate 调整。
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建限速器，bytesPerSecond 为 0 表示不限速
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{
+		rate:   bytesPerSecond,
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// SetRate 调整速率 (字节/秒)，0 表示不限速
+func (l *RateLimiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = bytesPerSecond
+	if l.tokens > float64(bytesPerSecond) {
+		l.tokens = float64(bytesPerSecond)
+	}
+}
+
+// Rate 返回当前速率 (字节/秒)
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// WaitN 扣除 n 个字节的令牌，令牌不足时等待，ctx 取消时返回 ctx.Err()
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.refill(now)
+
+		if l.rate <= 0 || l.tokens >= 0 {
+			if l.rate > 0 {
+				l.tokens -= float64(n)
+			}
+			l.mu.Unlock()
+			return nil
+		}
+
+		wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		if wait > maxLimitWait {
+			wait = maxLimitWait
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// refill 按经过的时间补充令牌，调用方需持有 l.mu
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestGetRateLimit 测试全局限速作用于响应体读取，调整为 0 后不再限速
+func TestGetRateLimit(t *testing.T) {
+	body := bytes.Repeat([]byte{0x47}, 64*1024)
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := newTestClient(5 * time.Second)
+	client.SetRateLimit(32 * 1024)
+
+	start := time.Now()
+	data, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	if len(data) != len(body) {
+		t.Fatalf("期望 %d 字节, 得到 %d", len(body), len(data))
+	}
+	// 桶中初始有一秒的令牌，剩余的 32KB 需要约 1 秒
+	if elapsed := time.Since(start); elapsed < 700*time.Millisecond {
+		t.Errorf("限速未生效, 耗时 %v", elapsed)
+	}
+
+	client.SetRateLimit(0)
+	start = time.Now()
+	if _, err := client.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("取消限速后仍然受限, 耗时 %v", elapsed)
+	}
+}
+
+// TestRateLimiterCanceled 测试等待令牌时 ctx 取消立即返回
+func TestRateLimiterCanceled(t *testing.T) {
+	limiter := NewRateLimiter(1024)
+	if err := limiter.WaitN(context.Background(), 1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := limiter.WaitN(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("期望 context.DeadlineExceeded, 得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取消后仍在等待, 耗时 %v", elapsed)
+	}
+}
@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile 按大小轮转的日志文件
+//
+// 当前文件写满 maxSize 字节后重命名为 <path>.1，已有的 <path>.N 依次后移，
+// 超过 maxBackups 的旧文件被删除。maxSize 为 0 时不轮转。
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile 以追加方式打开日志文件，必要时创建目录
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write 写入一条完整的日志，写入前超出大小限制时先轮转
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close 关闭日志文件
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backupName(i), r.backupName(i+1))
+		}
+		if err := os.Rename(r.path, r.backupName(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	r.removeExpired()
+	return r.open()
+}
+
+func (r *RotatingFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// removeExpired 删除超过保留数量的旧日志 (例如 maxBackups 调小之后遗留的文件)
+func (r *RotatingFile) removeExpired() {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+
+	for _, m := range matches {
+		var n int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(m, r.path+"."), "%d", &n); err != nil {
+			continue
+		}
+		if n > r.maxBackups {
+			os.Remove(m)
+		}
+	}
+}
+
+// FileLogger 写入日志文件的纯文本日志实现，不带颜色码
+type FileLogger struct {
+	level Level
+	w     *RotatingFile
+}
+
+// NewFile 创建写入轮转日志文件的日志记录器
+//
+// maxSizeMB 为单个文件的大小上限 (MB)，maxBackups 为保留的旧文件数量。
+func NewFile(path, levelStr string, maxSizeMB, maxBackups int) (*FileLogger, error) {
+	w, err := OpenRotatingFile(path, int64(maxSizeMB)<<20, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogger{
+		level: parseLevel(levelStr),
+		w:     w,
+	}, nil
+}
+
+// Close 关闭日志文件
+func (l *FileLogger) Close() error {
+	return l.w.Close()
+}
+
+func (l *FileLogger) Debug(msg string, args ...interface{}) {
+	if l.level <= DebugLevel {
+		l.entry(DebugLevel, format(msg, args), nil)
+	}
+}
+
+func (l *FileLogger) Info(msg string, args ...interface{}) {
+	if l.level <= InfoLevel {
+		l.entry(InfoLevel, format(msg, args), nil)
+	}
+}
+
+func (l *FileLogger) Warn(msg string, args ...interface{}) {
+	if l.level <= WarnLevel {
+		l.entry(WarnLevel, format(msg, args), nil)
+	}
+}
+
+func (l *FileLogger) Error(msg string, args ...interface{}) {
+	if l.level <= ErrorLevel {
+		l.entry(ErrorLevel, format(msg, args), nil)
+	}
+}
+
+func (l *FileLogger) Fatal(msg string, args ...interface{}) {
+	l.entry(FatalLevel, format(msg, args), nil)
+	os.Exit(1)
+}
+
+func (l *FileLogger) DebugWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= DebugLevel {
+		l.entry(DebugLevel, msg, fields)
+	}
+}
+
+func (l *FileLogger) InfoWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= InfoLevel {
+		l.entry(InfoLevel, msg, fields)
+	}
+}
+
+func (l *FileLogger) ErrorWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= ErrorLevel {
+		l.entry(ErrorLevel, msg, fields)
+	}
+}
+
+func (l *FileLogger) entry(level Level, msg string, fields map[string]interface{}) {
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006-01-02 15:04:05"))
+	b.WriteString(" [")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	b.WriteString(ansiPattern.ReplaceAllString(msg, ""))
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, fields[k])
+	}
+	b.WriteByte('\n')
+
+	l.w.Write([]byte(b.String()))
+}
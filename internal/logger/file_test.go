@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"m3u8-downloader/internal/theme"
+)
+
+// TestRotatingFile 测试超出大小后轮转并只保留指定数量的旧文件
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m3u8-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "download.log")
+	// 遗留的超出保留数量的旧文件
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path+".5", []byte("old\n"), 0644)
+
+	w, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		path:        "line-4\n",
+		path + ".1": "line-3\n",
+		path + ".2": "line-2\n",
+	}
+	for name, content := range want {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s 期望 %q, 得到 %q", filepath.Base(name), content, data)
+		}
+	}
+	for _, name := range []string{path + ".3", path + ".5"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s 应被删除", filepath.Base(name))
+		}
+	}
+}
+
+// TestFileLoggerTee 测试日志文件按自己的级别写入不带颜色的文本
+func TestFileLoggerTee(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m3u8-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "download.log")
+	file, err := NewFile(path, "warn", 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var console countLogger
+	log := Tee(&console, file)
+
+	log.Info("开始下载")
+	log.Warn("分片 %d 重试", 7)
+	log.ErrorWithFields(theme.Red+"分片失败"+theme.Reset, map[string]interface{}{"index": 7, "error": "timeout"})
+	file.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("期望 2 行, 得到 %q", data)
+	}
+	if !strings.HasSuffix(lines[0], "[WARN] 分片 7 重试") {
+		t.Errorf("第一行错误: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "[ERROR] 分片失败 error=timeout index=7") {
+		t.Errorf("第二行错误: %q", lines[1])
+	}
+	if console.n != 3 {
+		t.Errorf("控制台应收到 3 条日志, 得到 %d", console.n)
+	}
+}
+
+// countLogger 只计数的日志实现
+type countLogger struct{ n int }
+
+func (l *countLogger) Debug(string, ...interface{})                   { l.n++ }
+func (l *countLogger) Info(string, ...interface{})                    { l.n++ }
+func (l *countLogger) Warn(string, ...interface{})                    { l.n++ }
+func (l *countLogger) Error(string, ...interface{})                   { l.n++ }
+func (l *countLogger) Fatal(string, ...interface{})                   { l.n++ }
+func (l *countLogger) DebugWithFields(string, map[string]interface{}) { l.n++ }
+func (l *countLogger) InfoWithFields(string, map[string]interface{})  { l.n++ }
+func (l *countLogger) ErrorWithFields(string, map[string]interface{}) { l.n++ }
@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ansiPattern 匹配终端颜色转义序列
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// JSONLogger 每行输出一个 JSON 对象的结构化日志实现
+//
+// 字段: time (RFC 3339)、level、msg，*WithFields 的字段放在 fields 中。
+// 消息中的终端颜色码会被去除，便于日志采集。
+type JSONLogger struct {
+	level Level
+	mu    sync.Mutex
+	w     io.Writer
+}
+
+// jsonEntry 一行 JSON 日志
+type jsonEntry struct {
+	Time   string                 `json:"time"`
+	Level  string                 `json:"level"`
+	Msg    string                 `json:"msg"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// NewJSON 创建输出到 w 的 JSON 日志记录器
+func NewJSON(levelStr string, w io.Writer) Logger {
+	return &JSONLogger{
+		level: parseLevel(levelStr),
+		w:     w,
+	}
+}
+
+// NewWithFormat 按格式创建日志记录器: text 输出彩色文本到标准输出，
+// json 输出 JSON 行到标准错误，避免与进度条混在一起
+func NewWithFormat(levelStr, format string) Logger {
+	if format == FormatJSON {
+		return NewJSON(levelStr, os.Stderr)
+	}
+	return New(levelStr)
+}
+
+func (l *JSONLogger) Debug(msg string, args ...interface{}) {
+	if l.level <= DebugLevel {
+		l.log(DebugLevel, format(msg, args), nil)
+	}
+}
+
+func (l *JSONLogger) Info(msg string, args ...interface{}) {
+	if l.level <= InfoLevel {
+		l.log(InfoLevel, format(msg, args), nil)
+	}
+}
+
+func (l *JSONLogger) Warn(msg string, args ...interface{}) {
+	if l.level <= WarnLevel {
+		l.log(WarnLevel, format(msg, args), nil)
+	}
+}
+
+func (l *JSONLogger) Error(msg string, args ...interface{}) {
+	if l.level <= ErrorLevel {
+		l.log(ErrorLevel, format(msg, args), nil)
+	}
+}
+
+func (l *JSONLogger) Fatal(msg string, args ...interface{}) {
+	l.log(FatalLevel, format(msg, args), nil)
+	os.Exit(1)
+}
+
+func (l *JSONLogger) DebugWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= DebugLevel {
+		l.log(DebugLevel, msg, fields)
+	}
+}
+
+func (l *JSONLogger) InfoWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= InfoLevel {
+		l.log(InfoLevel, msg, fields)
+	}
+}
+
+func (l *JSONLogger) ErrorWithFields(msg string, fields map[string]interface{}) {
+	if l.level <= ErrorLevel {
+		l.log(ErrorLevel, msg, fields)
+	}
+}
+
+func (l *JSONLogger) log(level Level, msg string, fields map[string]interface{}) {
+	entry := jsonEntry{
+		Time:   time.Now().Format(time.RFC3339Nano),
+		Level:  strings.ToLower(level.String()),
+		Msg:    ansiPattern.ReplaceAllString(msg, ""),
+		Fields: jsonFields(fields),
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		// 字段无法序列化时退化为字符串
+		for k, v := range entry.Fields {
+			entry.Fields[k] = fmt.Sprint(v)
+		}
+		line, _ = json.Marshal(entry)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+func (l *JSONLogger) entry(level Level, msg string, fields map[string]interface{}) {
+	l.log(level, msg, fields)
+}
+
+func format(msg string, args []interface{}) string {
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// jsonFields 复制字段，error 与 Stringer 转为字符串
+func jsonFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		switch v := v.(type) {
+		case error:
+			out[k] = v.Error()
+		case fmt.Stringer:
+			out[k] = v.String()
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
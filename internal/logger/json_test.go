@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"m3u8-downloader/internal/theme"
+)
+
+// TestJSONLogger 测试每行输出一个 JSON 对象
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSON("info", &buf)
+
+	logger.Debug("should be filtered")
+	logger.Info("下载 %d 个分片到 %s", 3, theme.Lavender+"/tmp/movie"+theme.Reset)
+	logger.ErrorWithFields("分片失败", map[string]interface{}{
+		"index":   7,
+		"error":   errors.New("timeout"),
+		"elapsed": 1500 * time.Millisecond,
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("期望 2 行, 得到 %d: %q", len(lines), buf.String())
+	}
+
+	var entry struct {
+		Time   string                 `json:"time"`
+		Level  string                 `json:"level"`
+		Msg    string                 `json:"msg"`
+		Fields map[string]interface{} `json:"fields"`
+	}
+
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("第一行不是合法 JSON: %v", err)
+	}
+	if entry.Level != "info" || entry.Msg != "下载 3 个分片到 /tmp/movie" {
+		t.Errorf("第一行内容错误: %+v", entry)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+		t.Errorf("时间格式错误: %v", err)
+	}
+	if entry.Fields != nil {
+		t.Errorf("无字段时不应输出 fields: %v", entry.Fields)
+	}
+
+	entry.Fields = nil
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("第二行不是合法 JSON: %v", err)
+	}
+	if entry.Level != "error" || entry.Msg != "分片失败" {
+		t.Errorf("第二行内容错误: %+v", entry)
+	}
+	if entry.Fields["index"] != float64(7) || entry.Fields["error"] != "timeout" || entry.Fields["elapsed"] != "1.5s" {
+		t.Errorf("字段错误: %v", entry.Fields)
+	}
+}
+
+// TestNewWithFormat 测试按格式选择日志实现
+func TestNewWithFormat(t *testing.T) {
+	if _, ok := NewWithFormat("info", FormatJSON).(*JSONLogger); !ok {
+		t.Error("json 格式应创建 JSONLogger")
+	}
+	if _, ok := NewWithFormat("info", FormatText).(*ConsoleLogger); !ok {
+		t.Error("text 格式应创建 ConsoleLogger")
+	}
+}
@@ -185,6 +185,14 @@ func (l *ConsoleLogger) logWithFields(level Level, msg string, fields map[string
 	})
 }
 
+func (l *ConsoleLogger) entry(level Level, msg string, fields map[string]interface{}) {
+	if len(fields) > 0 {
+		l.logWithFields(level, msg, fields)
+		return
+	}
+	l.log(level, msg)
+}
+
 /* ---------- progress redraw support ---------- */
 
 var (
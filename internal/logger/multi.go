@@ -0,0 +1,76 @@
+package logger
+
+import "os"
+
+// entryWriter 能直接写入一条指定级别日志的实现，用于 Fatal 时各输出只写不退出
+type entryWriter interface {
+	entry(level Level, msg string, fields map[string]interface{})
+}
+
+// multiLogger 把每条日志转发给多个输出，各输出按自己的级别过滤
+type multiLogger struct {
+	loggers []Logger
+}
+
+// Tee 创建同时写入多个输出的日志记录器，例如控制台加日志文件
+func Tee(loggers ...Logger) Logger {
+	if len(loggers) == 1 {
+		return loggers[0]
+	}
+	return &multiLogger{loggers: loggers}
+}
+
+func (m *multiLogger) Debug(msg string, args ...interface{}) {
+	for _, l := range m.loggers {
+		l.Debug(msg, args...)
+	}
+}
+
+func (m *multiLogger) Info(msg string, args ...interface{}) {
+	for _, l := range m.loggers {
+		l.Info(msg, args...)
+	}
+}
+
+func (m *multiLogger) Warn(msg string, args ...interface{}) {
+	for _, l := range m.loggers {
+		l.Warn(msg, args...)
+	}
+}
+
+func (m *multiLogger) Error(msg string, args ...interface{}) {
+	for _, l := range m.loggers {
+		l.Error(msg, args...)
+	}
+}
+
+// Fatal 先让每个输出记录日志，最后统一退出
+func (m *multiLogger) Fatal(msg string, args ...interface{}) {
+	msg = format(msg, args)
+	for _, l := range m.loggers {
+		if w, ok := l.(entryWriter); ok {
+			w.entry(FatalLevel, msg, nil)
+		} else {
+			l.Error(msg)
+		}
+	}
+	os.Exit(1)
+}
+
+func (m *multiLogger) DebugWithFields(msg string, fields map[string]interface{}) {
+	for _, l := range m.loggers {
+		l.DebugWithFields(msg, fields)
+	}
+}
+
+func (m *multiLogger) InfoWithFields(msg string, fields map[string]interface{}) {
+	for _, l := range m.loggers {
+		l.InfoWithFields(msg, fields)
+	}
+}
+
+func (m *multiLogger) ErrorWithFields(msg string, fields map[string]interface{}) {
+	for _, l := range m.loggers {
+		l.ErrorWithFields(msg, fields)
+	}
+}
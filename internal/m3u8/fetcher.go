@@ -1,6 +1,7 @@
 package m3u8
 
 import (
+	"context"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -12,25 +13,48 @@ import (
 
 // Fetcher M3U8 获取接口
 type Fetcher interface {
-	FetchManifest(m3u8URL string, cookie string) (*Manifest, error)
+	FetchManifest(ctx context.Context, m3u8URL string, headers map[string]string) (*Manifest, error)
+	// SetQuality 设置遇到主播放列表时的码率变体选择器
+	SetQuality(quality string)
+	// SetHostType 设置相对路径的拼接方式 (v1, v2)，见 ExtractHost
+	SetHostType(hostType string)
 }
 
 // M3U8Fetcher M3U8 获取器实现
 type M3U8Fetcher struct {
 	httpClient http.Client
+	quality    string
+	hostType   string
 	logger     logger.Logger
+	// keys 所有获取共享的密钥缓存，重复获取 (直播轮询) 时不再重复下载密钥
+	keys *keyCache
 }
 
 // NewFetcher 创建新的 M3U8 获取器
 func NewFetcher(httpClient http.Client, logger logger.Logger) Fetcher {
 	return &M3U8Fetcher{
 		httpClient: httpClient,
+		quality:    "best",
+		hostType:   "v1",
 		logger:     logger,
+		keys:       newKeyCache(),
 	}
 }
 
+// SetQuality 设置遇到主播放列表时的码率变体选择器
+func (f *M3U8Fetcher) SetQuality(quality string) {
+	f.quality = quality
+}
+
+// SetHostType 设置相对路径的拼接方式 (v1, v2)，见 ExtractHost
+func (f *M3U8Fetcher) SetHostType(hostType string) {
+	f.hostType = hostType
+}
+
 // FetchManifest 获取 M3U8 清单文件
-func (f *M3U8Fetcher) FetchManifest(m3u8URL string, cookie string) (*Manifest, error) {
+//
+// headers 会附加到播放列表和密钥请求中。
+func (f *M3U8Fetcher) FetchManifest(ctx context.Context, m3u8URL string, headers map[string]string) (*Manifest, error) {
 	// 验证 URL
 	if !strings.HasPrefix(m3u8URL, "http") {
 		return nil, errors.New(errors.InvalidURL, "M3U8 URL 必须以 http 或 https 开头", nil)
@@ -38,34 +62,87 @@ func (f *M3U8Fetcher) FetchManifest(m3u8URL string, cookie string) (*Manifest, e
 
 	f.logger.Info("获取 M3U8 清单: %s", m3u8URL)
 
-	// 获取 M3U8 内容
-	var content []byte
-	var err error
+	content, err := f.fetch(ctx, m3u8URL, headers)
+	if err != nil {
+		return nil, err
+	}
 
-	if cookie != "" {
-		content, err = f.httpClient.GetWithCookie(m3u8URL, cookie)
-	} else {
-		content, err = f.httpClient.Get(m3u8URL)
+	// 主播放列表: 选择码率变体后获取对应的媒体播放列表
+	if IsMasterPlaylist(content) {
+		parser, err := f.newParser(m3u8URL, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		master, err := parser.ParseMaster(content)
+		if err != nil {
+			return nil, err
+		}
+
+		variant, err := SelectVariant(master, f.quality)
+		if err != nil {
+			return nil, err
+		}
+
+		f.logger.Info("选择码率变体: 带宽 %d, 分辨率 %s, 编码 %s",
+			variant.Bandwidth, valueOrDash(variant.Resolution), valueOrDash(variant.Codecs))
+
+		m3u8URL = variant.URL
+		content, err = f.fetch(ctx, m3u8URL, headers)
+		if err != nil {
+			return nil, err
+		}
+
+		if IsMasterPlaylist(content) {
+			return nil, errors.New(errors.M3U8Invalid, "码率变体指向了另一个主播放列表", nil)
+		}
 	}
 
+	// 创建解析器并解析
+	parser, err := f.newParser(m3u8URL, headers)
 	if err != nil {
-		return nil, errors.New(errors.M3U8Parse, "获取 M3U8 文件失败", err)
+		return nil, err
 	}
 
-	// 提取主机
-	hostURL, err := ExtractHost(m3u8URL, "v1")
+	manifest, err := parser.Parse(ctx, content)
 	if err != nil {
 		return nil, err
 	}
+	manifest.URL = m3u8URL
 
-	// 创建解析器并解析
-	parser := NewParser(hostURL, f.httpClient, f.logger)
-	manifest, err := parser.Parse(string(content))
+	return manifest, nil
+}
+
+func (f *M3U8Fetcher) fetch(ctx context.Context, m3u8URL string, headers map[string]string) (string, error) {
+	content, err := f.httpClient.GetWithHeaders(ctx, m3u8URL, headers)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", errors.New(errors.M3U8Parse, "获取 M3U8 文件失败", err)
+	}
+
+	return string(content), nil
+}
+
+// newParser 为一次获取创建解析器，每次获取使用独立的解析器，可以并发调用
+func (f *M3U8Fetcher) newParser(m3u8URL string, headers map[string]string) (Parser, error) {
+	// 提取主机
+	hostURL, err := ExtractHost(m3u8URL, f.hostType)
 	if err != nil {
 		return nil, err
 	}
 
-	return manifest, nil
+	parser := newParser(hostURL, f.httpClient, f.logger, f.keys)
+	parser.SetHeaders(headers)
+	return parser, nil
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
 // ExtractHost 从 M3U8 URL 提取主机
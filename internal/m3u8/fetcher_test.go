@@ -0,0 +1,39 @@
+package m3u8
+
+import (
+	"context"
+	"testing"
+
+	"m3u8-downloader/internal/logger"
+)
+
+// TestFetchManifestHostType 测试按主机类型拼接相对路径的段地址
+func TestFetchManifestHostType(t *testing.T) {
+	const playlistURL = "https://example.com/video/index.m3u8"
+	client := newStubClient(map[string][]byte{
+		playlistURL: []byte("#EXTM3U\n#EXTINF:10,\nseg0.ts\n#EXTINF:10,\n/live/seg1.ts\n#EXT-X-ENDLIST\n"),
+	})
+
+	tests := []struct {
+		hostType string
+		want     []string
+	}{
+		{"v1", []string{"https://example.com/video/seg0.ts", "https://example.com/video/live/seg1.ts"}},
+		{"v2", []string{"https://example.com/seg0.ts", "https://example.com/live/seg1.ts"}},
+	}
+
+	for _, tt := range tests {
+		fetcher := NewFetcher(client, logger.New("fatal"))
+		fetcher.SetHostType(tt.hostType)
+
+		manifest, err := fetcher.FetchManifest(context.Background(), playlistURL, nil)
+		if err != nil {
+			t.Fatalf("FetchManifest 失败: %v", err)
+		}
+		for i, want := range tt.want {
+			if got := manifest.Segments[i].URL; got != want {
+				t.Errorf("%s: 期望段地址 %s, 得到 %s", tt.hostType, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package m3u8
+
+import "sync"
+
+// maxCachedKeys 密钥缓存的容量，超出后淘汰最早加入的密钥
+//
+// 直播流通常定期轮换密钥，只需要保留最近的若干个。
+const maxCachedKeys = 64
+
+// keyCache 按 URI 缓存已下载的密钥数据，可被多个解析器并发使用
+type keyCache struct {
+	mu    sync.Mutex
+	data  map[string][]byte
+	order []string
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{data: make(map[string][]byte)}
+}
+
+// get 返回 URI 对应的密钥数据
+func (c *keyCache) get(uri string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.data[uri]
+	return data, ok
+}
+
+// put 缓存密钥数据，超出容量时淘汰最早的密钥
+func (c *keyCache) put(uri string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.data[uri]; !ok {
+		c.order = append(c.order, uri)
+	}
+	c.data[uri] = data
+
+	for len(c.order) > maxCachedKeys {
+		delete(c.data, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -0,0 +1,34 @@
+package m3u8
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestKeyCacheEvicts 测试密钥缓存的并发访问与容量上限
+func TestKeyCacheEvicts(t *testing.T) {
+	cache := newKeyCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxCachedKeys+10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.put(fmt.Sprintf("key%d", i), []byte{byte(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	if len(cache.data) != maxCachedKeys || len(cache.order) != maxCachedKeys {
+		t.Errorf("期望缓存 %d 个密钥, 得到 %d (%d)", maxCachedKeys, len(cache.data), len(cache.order))
+	}
+
+	cache.put("latest", []byte("k"))
+	if data, ok := cache.get("latest"); !ok || string(data) != "k" {
+		t.Errorf("最新的密钥不应被淘汰: %q %v", data, ok)
+	}
+	if _, ok := cache.get(cache.order[0]); !ok {
+		t.Error("队首的密钥应仍在缓存中")
+	}
+}
@@ -1,9 +1,16 @@
 package m3u8
 
 import (
+	"context"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
+	"m3u8-downloader/internal/config"
 	"m3u8-downloader/internal/errors"
 	"m3u8-downloader/internal/http"
 	"m3u8-downloader/internal/logger"
@@ -14,25 +21,79 @@ type TsSegment struct {
 	Name     string
 	URL      string
 	Duration float64
+	// Sequence 媒体序列号 (#EXT-X-MEDIA-SEQUENCE + 段在列表中的位置)
+	Sequence int64
+	// Key 该段生效的加密密钥，nil 表示未加密
+	Key *EncryptionKey
 }
 
+// IV 返回解密该段使用的初始向量
+//
+// 密钥带 IV 属性时使用该值，否则按 HLS 规范使用媒体序列号的
+// 16 字节大端表示。
+func (s *TsSegment) IV() []byte {
+	if s.Key != nil && len(s.Key.IV) > 0 {
+		return s.Key.IV
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(s.Sequence))
+	return iv
+}
+
+// 加密方式
+const (
+	MethodNone   = "NONE"
+	MethodAES128 = "AES-128"
+)
+
 // EncryptionKey 加密密钥信息
 type EncryptionKey struct {
 	Method string
 	URL    string
-	IV     string
+	IV     []byte
 	Data   []byte
 }
 
 // Manifest M3U8 清单文件
 type Manifest struct {
-	Segments []*TsSegment
-	Key      *EncryptionKey
+	// URL 媒体播放列表地址 (主播放列表选择变体后的地址)
+	URL            string
+	Segments       []*TsSegment
+	MediaSequence  int64
+	TargetDuration float64
+	// EndList 是否包含 #EXT-X-ENDLIST (不包含时可能是直播流)
+	EndList bool
+}
+
+// Variant 主播放列表中的一个码率变体
+type Variant struct {
+	URL        string
+	Bandwidth  int
+	Width      int
+	Height     int
+	Resolution string
+	Codecs     string
+}
+
+// MasterPlaylist 主播放列表 (多码率自适应)
+type MasterPlaylist struct {
+	Variants []*Variant
 }
 
 // Parser M3U8 解析器接口
+//
+// Parse 可能需要下载密钥，ctx 用于取消这些请求。
 type Parser interface {
-	Parse(content string) (*Manifest, error)
+	Parse(ctx context.Context, content string) (*Manifest, error)
+	ParseMaster(content string) (*MasterPlaylist, error)
+	// SetHeaders 设置获取密钥时附加的请求头
+	SetHeaders(headers map[string]string)
+}
+
+// IsMasterPlaylist 判断内容是否为主播放列表
+func IsMasterPlaylist(content string) bool {
+	return strings.Contains(content, "#EXT-X-STREAM-INF")
 }
 
 // M3U8Parser M3U8 解析器实现
@@ -40,23 +101,42 @@ type M3U8Parser struct {
 	hostURL    string
 	httpClient http.Client
 	logger     logger.Logger
+	// headers 获取密钥时附加的请求头
+	headers map[string]string
+	// keys 按 URI 缓存已下载的密钥，轮换回旧密钥时不再重复获取
+	keys *keyCache
 }
 
 // NewParser 创建新的 M3U8 解析器
 func NewParser(hostURL string, httpClient http.Client, logger logger.Logger) Parser {
+	return newParser(hostURL, httpClient, logger, newKeyCache())
+}
+
+// newParser 创建使用指定密钥缓存的解析器，同一获取器创建的解析器共享缓存
+func newParser(hostURL string, httpClient http.Client, logger logger.Logger, keys *keyCache) *M3U8Parser {
 	return &M3U8Parser{
 		hostURL:    hostURL,
 		httpClient: httpClient,
 		logger:     logger,
+		keys:       keys,
 	}
 }
 
+// SetHeaders 设置获取密钥时附加的请求头
+func (p *M3U8Parser) SetHeaders(headers map[string]string) {
+	p.headers = headers
+}
+
 // Parse 解析 M3U8 清单文件
-func (p *M3U8Parser) Parse(content string) (*Manifest, error) {
+func (p *M3U8Parser) Parse(ctx context.Context, content string) (*Manifest, error) {
 	if content == "" {
 		return nil, errors.New(errors.M3U8Parse, "M3U8 内容为空", nil)
 	}
 
+	if IsMasterPlaylist(content) {
+		return nil, errors.New(errors.M3U8Invalid, "这是主播放列表，请先选择码率变体", nil)
+	}
+
 	manifest := &Manifest{
 		Segments: make([]*TsSegment, 0),
 	}
@@ -64,17 +144,48 @@ func (p *M3U8Parser) Parse(content string) (*Manifest, error) {
 	lines := strings.Split(content, "\n")
 	index := 0
 
+	// 当前生效的密钥，直到下一个 #EXT-X-KEY 为止
+	var currentKey *EncryptionKey
+	var pendingDuration float64
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
 		// 跳过注释和空行
 		if line == "" || strings.HasPrefix(line, "#") {
-			// 处理加密密钥信息
-			if strings.Contains(line, "#EXT-X-KEY") {
-				key, err := p.parseKey(line)
-				if err == nil {
-					manifest.Key = key
+			// 第一个段的媒体序列号
+			if strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:") {
+				seq, err := strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+				if err != nil {
+					p.logger.Warn("解析媒体序列号失败: %v", err)
+				} else {
+					manifest.MediaSequence = seq
+				}
+			}
+
+			switch {
+			case strings.HasPrefix(line, "#EXTINF:"):
+				pendingDuration = parseDuration(strings.TrimPrefix(line, "#EXTINF:"))
+			case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+				manifest.TargetDuration = parseDuration(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			case line == "#EXT-X-ENDLIST":
+				manifest.EndList = true
+			}
+
+			// 处理加密密钥信息 (可能在播放列表中途轮换)
+			if strings.HasPrefix(line, "#EXT-X-KEY:") {
+				// 沿用上一个密钥会用错误的密钥解密之后的段，直接失败
+				key, err := p.parseKey(ctx, line)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					if errors.IsCode(err, errors.M3U8Invalid) {
+						return nil, err
+					}
+					return nil, errors.New(errors.M3U8Parse, "解析加密密钥失败", err)
 				}
+				currentKey = key
 			}
 			continue
 		}
@@ -86,6 +197,10 @@ func (p *M3U8Parser) Parse(content string) (*Manifest, error) {
 			p.logger.Warn("解析 TS 段失败: %v", err)
 			continue
 		}
+		segment.Sequence = manifest.MediaSequence + int64(index-1)
+		segment.Duration = pendingDuration
+		segment.Key = currentKey
+		pendingDuration = 0
 
 		manifest.Segments = append(manifest.Segments, segment)
 	}
@@ -99,6 +214,170 @@ func (p *M3U8Parser) Parse(content string) (*Manifest, error) {
 	return manifest, nil
 }
 
+// ParseMaster 解析主播放列表
+func (p *M3U8Parser) ParseMaster(content string) (*MasterPlaylist, error) {
+	if content == "" {
+		return nil, errors.New(errors.M3U8Parse, "M3U8 内容为空", nil)
+	}
+
+	master := &MasterPlaylist{
+		Variants: make([]*Variant, 0),
+	}
+
+	lines := strings.Split(content, "\n")
+	var pending *Variant
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			pending = parseStreamInf(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// 紧跟在 #EXT-X-STREAM-INF 之后的 URI 行
+		if pending != nil {
+			pending.URL = p.resolveURL(line)
+			master.Variants = append(master.Variants, pending)
+			pending = nil
+		}
+	}
+
+	if len(master.Variants) == 0 {
+		return nil, errors.New(errors.M3U8Invalid, "主播放列表中未找到码率变体", nil)
+	}
+
+	p.logger.Info("成功解析主播放列表, 共 %d 个码率变体", len(master.Variants))
+
+	return master, nil
+}
+
+// parseDuration 解析 "10.010," 形式的时长，忽略逗号后的标题
+func parseDuration(value string) float64 {
+	if comma := strings.Index(value, ","); comma != -1 {
+		value = value[:comma]
+	}
+	d, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return d
+}
+
+func parseStreamInf(attrs string) *Variant {
+	v := &Variant{}
+	for k, val := range parseAttributes(attrs) {
+		switch k {
+		case "BANDWIDTH":
+			v.Bandwidth, _ = strconv.Atoi(val)
+		case "RESOLUTION":
+			v.Resolution = val
+			parts := strings.SplitN(strings.ToLower(val), "x", 2)
+			if len(parts) == 2 {
+				v.Width, _ = strconv.Atoi(parts[0])
+				v.Height, _ = strconv.Atoi(parts[1])
+			}
+		case "CODECS":
+			v.Codecs = val
+		}
+	}
+	return v
+}
+
+// parseAttributes 解析 M3U8 属性列表 (KEY=VALUE,KEY="VALUE,...")
+func parseAttributes(attrs string) map[string]string {
+	result := make(map[string]string)
+
+	for len(attrs) > 0 {
+		eq := strings.Index(attrs, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.TrimSpace(attrs[:eq])
+		attrs = attrs[eq+1:]
+
+		var value string
+		if strings.HasPrefix(attrs, "\"") {
+			end := strings.Index(attrs[1:], "\"")
+			if end == -1 {
+				value = attrs[1:]
+				attrs = ""
+			} else {
+				value = attrs[1 : end+1]
+				attrs = attrs[end+2:]
+			}
+			attrs = strings.TrimPrefix(attrs, ",")
+		} else {
+			comma := strings.Index(attrs, ",")
+			if comma == -1 {
+				value = attrs
+				attrs = ""
+			} else {
+				value = attrs[:comma]
+				attrs = attrs[comma+1:]
+			}
+		}
+
+		result[strings.ToUpper(key)] = strings.TrimSpace(value)
+	}
+
+	return result
+}
+
+// SelectVariant 按画质选择器挑选码率变体
+//
+// 支持的选择器:
+//
+//	best   - 带宽最高的变体 (默认)
+//	worst  - 带宽最低的变体
+//	720p   - 高度不超过 720 的变体中带宽最高者
+//	1500k  - 带宽不超过 1500 kbps 的变体中带宽最高者
+//
+// 若没有变体满足上限，则退回带宽最低的变体。
+func SelectVariant(master *MasterPlaylist, quality string) (*Variant, error) {
+	if master == nil || len(master.Variants) == 0 {
+		return nil, errors.New(errors.M3U8Invalid, "没有可选择的码率变体", nil)
+	}
+
+	variants := make([]*Variant, len(master.Variants))
+	copy(variants, master.Variants)
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Bandwidth != variants[j].Bandwidth {
+			return variants[i].Bandwidth < variants[j].Bandwidth
+		}
+		return variants[i].Height < variants[j].Height
+	})
+
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	switch {
+	case quality == "" || quality == "best":
+		return variants[len(variants)-1], nil
+	case quality == "worst":
+		return variants[0], nil
+	}
+
+	maxHeight, maxBandwidth, err := config.ParseQuality(quality)
+	if err != nil {
+		return nil, errors.New(errors.InvalidConfig, "画质选择器无效", err)
+	}
+
+	for i := len(variants) - 1; i >= 0; i-- {
+		v := variants[i]
+		if maxHeight > 0 && v.Height > 0 && v.Height <= maxHeight {
+			return v, nil
+		}
+		if maxBandwidth > 0 && v.Bandwidth <= maxBandwidth {
+			return v, nil
+		}
+	}
+
+	return variants[0], nil
+}
+
 func (p *M3U8Parser) parseSegment(url string, index int) (*TsSegment, error) {
 	url = strings.TrimSpace(url)
 
@@ -106,77 +385,100 @@ func (p *M3U8Parser) parseSegment(url string, index int) (*TsSegment, error) {
 		return nil, fmt.Errorf("URL 为空")
 	}
 
-	// 如果是绝对 URL，直接使用
-	if strings.HasPrefix(url, "http") {
-		return &TsSegment{
-			Name: fmt.Sprintf("%05d.ts", index),
-			URL:  url,
-		}, nil
-	}
-
-	// 否则拼接主机 URL
-	url = strings.TrimPrefix(url, "/")
-	fullURL := fmt.Sprintf("%s/%s", p.hostURL, url)
-
 	return &TsSegment{
 		Name: fmt.Sprintf("%05d.ts", index),
-		URL:  fullURL,
+		URL:  p.resolveURL(url),
 	}, nil
 }
 
-func (p *M3U8Parser) parseKey(line string) (*EncryptionKey, error) {
-	// 检查是否包含 URI
-	if !strings.Contains(line, "URI") {
-		return nil, fmt.Errorf("密钥信息中未找到 URI")
+// resolveURL 将相对路径拼接为完整 URL，绝对 URL 直接返回
+func (p *M3U8Parser) resolveURL(url string) string {
+	if strings.HasPrefix(url, "http") {
+		return url
 	}
+	return fmt.Sprintf("%s/%s", p.hostURL, strings.TrimPrefix(url, "/"))
+}
 
-	// 提取 METHOD
-	method := "AES-128"
-	if strings.Contains(line, "METHOD=") {
-		start := strings.Index(line, "METHOD=")
-		end := strings.Index(line[start:], ",")
-		if end == -1 {
-			end = len(line) - start
-		}
-		methodPart := line[start+7 : start+end]
-		method = strings.Trim(methodPart, "\"")
-	}
+// parseKey 解析 #EXT-X-KEY 行; METHOD=NONE 时返回 nil 表示此后的段不加密，
+// AES-128 以外的加密方式返回 M3U8Invalid 错误
+func (p *M3U8Parser) parseKey(ctx context.Context, line string) (*EncryptionKey, error) {
+	attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
 
-	// 提取 URI
-	uriStart := strings.Index(line, "URI=")
-	if uriStart == -1 {
-		return nil, fmt.Errorf("未找到 URI 字段")
+	method := attrs["METHOD"]
+	if method == "" {
+		method = MethodAES128
 	}
 
-	// 查找引号对
-	firstQuote := strings.Index(line[uriStart:], "\"")
-	secondQuote := strings.Index(line[uriStart+firstQuote+1:], "\"")
+	if method == MethodNone {
+		return nil, nil
+	}
 
-	if firstQuote == -1 || secondQuote == -1 {
-		return nil, fmt.Errorf("URI 字段格式错误")
+	// SAMPLE-AES 等只加密部分数据，按整段 AES-128 解密只会得到损坏的段
+	if method != MethodAES128 {
+		return nil, errors.New(errors.M3U8Invalid, fmt.Sprintf("不支持的加密方式 %s (只支持 %s)", method, MethodAES128), nil)
 	}
 
-	keyURL := line[uriStart+firstQuote+1 : uriStart+firstQuote+1+secondQuote]
+	keyURL := attrs["URI"]
+	if keyURL == "" {
+		return nil, fmt.Errorf("密钥信息中未找到 URI")
+	}
 
 	// 构造完整 URL
-	if !strings.HasPrefix(keyURL, "http") {
-		keyURL = fmt.Sprintf("%s/%s", p.hostURL, strings.TrimPrefix(keyURL, "/"))
+	keyURL = p.resolveURL(keyURL)
+
+	iv, err := parseIV(attrs["IV"])
+	if err != nil {
+		return nil, err
 	}
 
 	key := &EncryptionKey{
 		Method: method,
 		URL:    keyURL,
+		IV:     iv,
 	}
 
-	// 尝试下载密钥数据
-	data, err := p.httpClient.Get(keyURL)
-	if err != nil {
-		p.logger.Warn("下载加密密钥失败: %v", err)
+	// 同一 URI 的密钥只下载一次
+	if data, ok := p.keys.get(keyURL); ok {
+		key.Data = data
 		return key, nil
 	}
 
+	// 下载密钥数据
+	data, err := p.httpClient.GetWithHeaders(ctx, keyURL, p.headers)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("下载密钥 %s 失败: %w", keyURL, err)
+	}
+	if len(data) != aes.BlockSize {
+		return nil, fmt.Errorf("密钥 %s 长度为 %d 字节, 应为 %d", keyURL, len(data), aes.BlockSize)
+	}
+
 	key.Data = data
+	p.keys.put(keyURL, data)
 	p.logger.Info("成功获取加密密钥: %s", keyURL)
 
 	return key, nil
 }
+
+// parseIV 解析十六进制 IV 属性 (0x 开头)，不足 16 字节时在高位补零
+func parseIV(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	hexStr := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if len(hexStr)%2 == 1 {
+		hexStr = "0" + hexStr
+	}
+
+	data, err := hex.DecodeString(hexStr)
+	if err != nil || len(data) > aes.BlockSize {
+		return nil, fmt.Errorf("IV 格式错误: %s", value)
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	copy(iv[aes.BlockSize-len(data):], data)
+	return iv, nil
+}
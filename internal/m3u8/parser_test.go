@@ -0,0 +1,262 @@
+package m3u8
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+)
+
+const masterContent = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+720p/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,URI="iframe.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2"
+https://cdn.example.com/1080p/index.m3u8
+`
+
+// stubClient 按 URL 返回固定内容并记录请求次数
+type stubClient struct {
+	bodies map[string][]byte
+	calls  map[string]int
+}
+
+func newStubClient(bodies map[string][]byte) *stubClient {
+	return &stubClient{bodies: bodies, calls: make(map[string]int)}
+}
+
+func (c *stubClient) Get(ctx context.Context, url string) ([]byte, error) {
+	c.calls[url]++
+	body, ok := c.bodies[url]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", url)
+	}
+	return body, nil
+}
+
+func (c *stubClient) GetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	return c.Get(ctx, url)
+}
+
+func (c *stubClient) GetWithCookie(ctx context.Context, url string, cookie string) ([]byte, error) {
+	return c.Get(ctx, url)
+}
+
+func newTestParser() Parser {
+	return NewParser("https://example.com/video", nil, logger.New("error"))
+}
+
+// TestParseMaster 测试主播放列表解析
+func TestParseMaster(t *testing.T) {
+	if !IsMasterPlaylist(masterContent) {
+		t.Fatal("期望识别为主播放列表")
+	}
+
+	master, err := newTestParser().ParseMaster(masterContent)
+	if err != nil {
+		t.Fatalf("ParseMaster 失败: %v", err)
+	}
+
+	if len(master.Variants) != 3 {
+		t.Fatalf("期望 3 个变体, 得到 %d", len(master.Variants))
+	}
+
+	v := master.Variants[1]
+	if v.Bandwidth != 2800000 || v.Width != 1280 || v.Height != 720 {
+		t.Errorf("变体属性解析错误: %+v", v)
+	}
+	if v.Codecs != "avc1.4d401f,mp4a.40.2" {
+		t.Errorf("期望 CODECS 保留逗号, 得到 %s", v.Codecs)
+	}
+	if v.URL != "https://example.com/video/720p/index.m3u8" {
+		t.Errorf("相对 URL 拼接错误: %s", v.URL)
+	}
+	if master.Variants[2].URL != "https://cdn.example.com/1080p/index.m3u8" {
+		t.Errorf("绝对 URL 不应改变: %s", master.Variants[2].URL)
+	}
+}
+
+// TestParseRejectsMaster 测试媒体播放列表解析拒绝主播放列表
+func TestParseRejectsMaster(t *testing.T) {
+	if _, err := newTestParser().Parse(context.Background(), masterContent); err == nil {
+		t.Error("期望主播放列表被 Parse 拒绝")
+	}
+}
+
+// TestSelectVariant 测试码率变体选择
+func TestSelectVariant(t *testing.T) {
+	master, err := newTestParser().ParseMaster(masterContent)
+	if err != nil {
+		t.Fatalf("ParseMaster 失败: %v", err)
+	}
+
+	tests := []struct {
+		quality   string
+		bandwidth int
+		wantErr   bool
+	}{
+		{"best", 5000000, false},
+		{"", 5000000, false},
+		{"worst", 800000, false},
+		{"720p", 2800000, false},
+		{"480p", 800000, false},
+		{"240p", 800000, false},
+		{"3000k", 2800000, false},
+		{"10000k", 5000000, false},
+		{"high", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quality, func(t *testing.T) {
+			v, err := SelectVariant(master, tt.quality)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectVariant(%q) error = %v, wantErr %v", tt.quality, err, tt.wantErr)
+			}
+			if !tt.wantErr && v.Bandwidth != tt.bandwidth {
+				t.Errorf("SelectVariant(%q) 期望带宽 %d, 得到 %d", tt.quality, tt.bandwidth, v.Bandwidth)
+			}
+		})
+	}
+}
+
+// TestParseKeyRotation 测试密钥轮换、密钥缓存与 METHOD=NONE
+func TestParseKeyRotation(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXTINF:10,
+seg1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key2.bin"
+#EXTINF:10,
+seg2.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+seg3.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXTINF:10,
+seg4.ts
+#EXT-X-ENDLIST
+`
+	client := newStubClient(map[string][]byte{
+		"https://example.com/video/key1.bin": []byte("1111111111111111"),
+		"https://example.com/video/key2.bin": []byte("2222222222222222"),
+	})
+	parser := NewParser("https://example.com/video", client, logger.New("error"))
+
+	manifest, err := parser.Parse(context.Background(), content)
+	if err != nil {
+		t.Fatalf("Parse 失败: %v", err)
+	}
+
+	if len(manifest.Segments) != 4 {
+		t.Fatalf("期望 4 个段, 得到 %d", len(manifest.Segments))
+	}
+
+	wantKeys := []string{"1111111111111111", "2222222222222222", "", "1111111111111111"}
+	for i, want := range wantKeys {
+		key := manifest.Segments[i].Key
+		if want == "" {
+			if key != nil {
+				t.Errorf("段 %d 期望未加密, 得到密钥 %s", i+1, key.URL)
+			}
+			continue
+		}
+		if key == nil || string(key.Data) != want {
+			t.Errorf("段 %d 密钥错误: %+v", i+1, key)
+		}
+	}
+
+	if n := client.calls["https://example.com/video/key1.bin"]; n != 1 {
+		t.Errorf("期望 key1 只下载 1 次, 实际 %d 次", n)
+	}
+}
+
+// TestParseKeyErrors 测试密钥无法解析或获取时解析失败，而不是沿用上一个密钥
+func TestParseKeyErrors(t *testing.T) {
+	client := newStubClient(map[string][]byte{
+		"https://example.com/video/key1.bin":  []byte("1111111111111111"),
+		"https://example.com/video/short.bin": []byte("123"),
+	})
+
+	cases := map[string]string{
+		"缺少 URI": `#EXT-X-KEY:METHOD=AES-128`,
+		"IV 无效":  `#EXT-X-KEY:METHOD=AES-128,URI="key1.bin",IV=0xZZ`,
+		"获取失败":   `#EXT-X-KEY:METHOD=AES-128,URI="missing.bin"`,
+		"长度错误":   `#EXT-X-KEY:METHOD=AES-128,URI="short.bin"`,
+	}
+	for name, rotated := range cases {
+		t.Run(name, func(t *testing.T) {
+			content := "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key1.bin\"\n#EXTINF:10,\nseg1.ts\n" +
+				rotated + "\n#EXTINF:10,\nseg2.ts\n"
+			parser := NewParser("https://example.com/video", client, logger.New("fatal"))
+
+			_, err := parser.Parse(context.Background(), content)
+			if !errors.IsCode(err, errors.M3U8Parse) {
+				t.Errorf("期望 %s 错误, 得到 %v", errors.M3U8Parse, err)
+			}
+		})
+	}
+}
+
+// TestParseUnsupportedKeyMethod 测试 AES-128 以外的加密方式在解析时失败，且不获取密钥
+func TestParseUnsupportedKeyMethod(t *testing.T) {
+	for _, method := range []string{"SAMPLE-AES", "SAMPLE-AES-CTR"} {
+		t.Run(method, func(t *testing.T) {
+			client := newStubClient(map[string][]byte{
+				"https://example.com/video/key.bin": []byte("1111111111111111"),
+			})
+			content := "#EXTM3U\n#EXT-X-KEY:METHOD=" + method + ",URI=\"key.bin\"\n#EXTINF:10,\nseg1.ts\n"
+			parser := NewParser("https://example.com/video", client, logger.New("fatal"))
+
+			_, err := parser.Parse(context.Background(), content)
+			if !errors.IsCode(err, errors.M3U8Invalid) {
+				t.Errorf("期望 %s 错误, 得到 %v", errors.M3U8Invalid, err)
+			}
+			if n := client.calls["https://example.com/video/key.bin"]; n != 0 {
+				t.Errorf("不应获取密钥, 实际 %d 次", n)
+			}
+		})
+	}
+}
+
+// TestSegmentIV 测试 IV 属性解析与按媒体序列号推导 IV
+func TestSegmentIV(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:258
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+seg1.ts
+#EXTINF:10,
+seg2.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x0000000000000000000000000000ABCD
+#EXTINF:10,
+seg3.ts
+`
+	client := newStubClient(map[string][]byte{
+		"https://example.com/video/key.bin": []byte("1111111111111111"),
+	})
+	parser := NewParser("https://example.com/video", client, logger.New("error"))
+
+	manifest, err := parser.Parse(context.Background(), content)
+	if err != nil {
+		t.Fatalf("Parse 失败: %v", err)
+	}
+
+	if manifest.MediaSequence != 258 {
+		t.Errorf("期望媒体序列号 258, 得到 %d", manifest.MediaSequence)
+	}
+
+	want := []string{
+		"00000000000000000000000000000102",
+		"00000000000000000000000000000103",
+		"0000000000000000000000000000abcd",
+	}
+	for i, seg := range manifest.Segments {
+		if got := fmt.Sprintf("%x", seg.IV()); got != want[i] {
+			t.Errorf("段 %d 期望 IV %s, 得到 %s", i+1, want[i], got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/progress"
+)
+
+// 段结果与任务结果的标签值
+const (
+	ResultDownloaded = "downloaded"
+	ResultSkipped    = "skipped"
+	ResultFailed     = "failed"
+	ResultSucceeded  = "succeeded"
+	ResultCanceled   = "canceled"
+)
+
+// mergeBuckets 合并耗时的桶上界 (秒)，覆盖短片的拼接到长视频的 FFmpeg 封装
+var mergeBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics 下载器的运行指标
+//
+// 所有方法在接收者为 nil 时什么都不做，未启用指标的组件无需判断。
+type Metrics struct {
+	registry *Registry
+
+	segments        *Counter
+	bytes           *Counter
+	httpResponses   *Counter
+	httpRetries     *Counter
+	decryptFailures *Counter
+	mergeDuration   *Histogram
+	activeJobs      *Gauge
+	jobs            *Counter
+}
+
+// New 创建并注册所有指标
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		registry: r,
+
+		segments: r.NewCounter("m3u8dl_segments_total",
+			"Segments by result (downloaded, skipped, failed).", "result"),
+		bytes: r.NewCounter("m3u8dl_downloaded_bytes_total",
+			"Bytes of segments written to disk."),
+		httpResponses: r.NewCounter("m3u8dl_http_responses_total",
+			"HTTP responses by status code; timeout and error count requests without a response.", "code"),
+		httpRetries: r.NewCounter("m3u8dl_http_retries_total",
+			"HTTP requests retried by the client."),
+		decryptFailures: r.NewCounter("m3u8dl_decrypt_failures_total",
+			"AES-128 segment decryption failures, including retried ones."),
+		mergeDuration: r.NewHistogram("m3u8dl_merge_duration_seconds",
+			"Time spent merging segments by merger and result.", mergeBuckets, "merger", "result"),
+		activeJobs: r.NewGauge("m3u8dl_active_jobs",
+			"Jobs currently downloading or merging."),
+		jobs: r.NewCounter("m3u8dl_jobs_total",
+			"Finished jobs by result (succeeded, failed, canceled).", "result"),
+	}
+}
+
+// Handler 返回 Prometheus 文本格式的 /metrics 处理器
+func (m *Metrics) Handler() http.Handler {
+	return m.registry.Handler()
+}
+
+// HTTPResponse 记录一次请求的结果: 状态码，或没有响应时的 timeout / error
+func (m *Metrics) HTTPResponse(code string) {
+	if m == nil {
+		return
+	}
+	m.httpResponses.Inc(code)
+}
+
+// HTTPStatus 记录一次请求的状态码
+func (m *Metrics) HTTPStatus(status int) {
+	m.HTTPResponse(strconv.Itoa(status))
+}
+
+// HTTPRetry 记录一次重试
+func (m *Metrics) HTTPRetry() {
+	if m == nil {
+		return
+	}
+	m.httpRetries.Inc()
+}
+
+// DecryptFailed 记录一次段解密失败
+func (m *Metrics) DecryptFailed() {
+	if m == nil {
+		return
+	}
+	m.decryptFailures.Inc()
+}
+
+// JobStarted 记录任务开始
+func (m *Metrics) JobStarted() {
+	if m == nil {
+		return
+	}
+	m.activeJobs.Add(1)
+}
+
+// JobFinished 记录任务结束，result 为 ResultSucceeded、ResultFailed 或 ResultCanceled
+func (m *Metrics) JobFinished(result string) {
+	if m == nil {
+		return
+	}
+	m.activeJobs.Add(-1)
+	m.jobs.Inc(result)
+}
+
+// Reporter 返回统计段与合并事件后转发给 next 的进度报告器，m 为 nil 时直接返回 next
+//
+// 每个任务使用单独的报告器，合并开始与结束按任务配对。
+func (m *Metrics) Reporter(next progress.Reporter) progress.Reporter {
+	if m == nil {
+		return next
+	}
+	return &reporter{metrics: m, next: next}
+}
+
+// reporter 从进度事件中统计段数、字节数与合并耗时
+type reporter struct {
+	metrics *Metrics
+	next    progress.Reporter
+
+	mu         sync.Mutex
+	mergeStart time.Time
+}
+
+func (r *reporter) Report(event progress.Event) {
+	m := r.metrics
+
+	switch event.Type {
+	case progress.SegmentSucceeded:
+		m.segments.Inc(ResultDownloaded)
+		if event.Segment != nil {
+			m.bytes.Add(float64(event.Segment.Bytes))
+		}
+	case progress.SegmentSkipped:
+		m.segments.Inc(ResultSkipped)
+	case progress.SegmentFailed:
+		m.segments.Inc(ResultFailed)
+	case progress.MergeStarted:
+		r.mu.Lock()
+		r.mergeStart = event.Time
+		r.mu.Unlock()
+	case progress.MergeFinished:
+		r.mu.Lock()
+		start := r.mergeStart
+		r.mu.Unlock()
+
+		if !start.IsZero() && event.Merge != nil {
+			result := ResultSucceeded
+			if event.Error != "" {
+				result = ResultFailed
+			}
+			m.mergeDuration.Observe(event.Time.Sub(start).Seconds(), event.Merge.Merger, result)
+		}
+	}
+
+	r.next.Report(event)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"m3u8-downloader/internal/progress"
+)
+
+// TestWriteText 测试文本格式: 标签转义、排序、仪表盘默认值与直方图的累计桶
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Test counter.", "code")
+	r.NewGauge("test_active", "Test gauge.")
+	h := r.NewHistogram("test_seconds", "Test histogram.", []float64{1, 5}, "kind")
+
+	c.Inc("404")
+	c.Add(2, "200")
+	c.Inc(`a"b`)
+	h.Observe(0.5, "x")
+	h.Observe(3, "x")
+	h.Observe(10, "x")
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("WriteText 失败: %v", err)
+	}
+
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{code="200"} 2
+test_total{code="404"} 1
+test_total{code="a\"b"} 1
+# HELP test_active Test gauge.
+# TYPE test_active gauge
+test_active 0
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{kind="x",le="1"} 1
+test_seconds_bucket{kind="x",le="5"} 2
+test_seconds_bucket{kind="x",le="+Inf"} 3
+test_seconds_sum{kind="x"} 13.5
+test_seconds_count{kind="x"} 3
+`
+	if out.String() != want {
+		t.Errorf("输出不一致:\n%s\n期望:\n%s", out.String(), want)
+	}
+}
+
+// TestReporter 测试从进度事件统计段、字节与合并耗时，nil 的 Metrics 不记录
+func TestReporter(t *testing.T) {
+	m := New()
+	r := m.Reporter(progress.NewSilent())
+
+	start := time.Now()
+	r.Report(progress.Event{Type: progress.SegmentSucceeded, Segment: &progress.Segment{Bytes: 1000}})
+	r.Report(progress.Event{Type: progress.SegmentSucceeded, Segment: &progress.Segment{Bytes: 500}})
+	r.Report(progress.Event{Type: progress.SegmentSkipped})
+	r.Report(progress.Event{Type: progress.SegmentFailed})
+	r.Report(progress.Event{Type: progress.MergeStarted, Time: start, Merge: &progress.Merge{Merger: "FFmpeg"}})
+	r.Report(progress.Event{Type: progress.MergeFinished, Time: start.Add(2 * time.Second), Merge: &progress.Merge{Merger: "FFmpeg"}})
+	m.JobStarted()
+	m.JobStarted()
+	m.JobFinished(ResultFailed)
+	m.DecryptFailed()
+
+	var out strings.Builder
+	m.registry.WriteText(&out)
+	for _, want := range []string{
+		`m3u8dl_segments_total{result="downloaded"} 2`,
+		`m3u8dl_segments_total{result="skipped"} 1`,
+		`m3u8dl_segments_total{result="failed"} 1`,
+		"m3u8dl_downloaded_bytes_total 1500",
+		`m3u8dl_merge_duration_seconds_bucket{merger="FFmpeg",result="succeeded",le="2.5"} 1`,
+		`m3u8dl_merge_duration_seconds_sum{merger="FFmpeg",result="succeeded"} 2`,
+		"m3u8dl_active_jobs 1",
+		`m3u8dl_jobs_total{result="failed"} 1`,
+		"m3u8dl_decrypt_failures_total 1",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("指标中缺少 %q:\n%s", want, out.String())
+		}
+	}
+
+	var disabled *Metrics
+	disabled.HTTPStatus(200)
+	disabled.JobStarted()
+	if next := progress.NewSilent(); disabled.Reporter(next) != next {
+		t.Error("nil 的 Metrics 应直接返回原报告器")
+	}
+}
@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry 指标集合，按 Prometheus 文本格式 (0.0.4) 输出
+//
+// 只实现本项目用到的计数器、仪表盘与直方图，避免引入 client_golang。
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric 一个指标族
+type metric interface {
+	write(w io.Writer)
+}
+
+// NewRegistry 创建空的指标集合
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounter 注册只增不减的计数器，labels 为标签名
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// NewGauge 注册可增可减的仪表盘
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{family: newFamily(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// NewHistogram 注册直方图，buckets 为升序的桶上界 (不含 +Inf)
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText 按注册顺序输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler 返回输出指标的 HTTP 处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// family 同名指标按标签值区分的一组序列
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series 一组标签值对应的数据
+type series struct {
+	labels []string
+	value  float64
+	// 直方图使用
+	counts []uint64
+	count  uint64
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// get 返回标签值对应的序列，不存在时创建，调用方需持有 f.mu
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签值, 得到 %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted 按标签值排序的序列，使输出稳定，调用方需持有 f.mu
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, key := range keys {
+		list[i] = f.series[key]
+	}
+	return list
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// labelEscaper 按文本格式转义标签值中的反斜杠、双引号与换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString 返回 {a="x",b="y"} 形式的标签，extra 为附加的键值对 (如 le)
+func (f *family) labelString(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range f.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[i], labelEscaper.Replace(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter 计数器
+type Counter struct {
+	family
+}
+
+// Inc 计数加一
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add 计数增加 v，v 不能为负
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.get(labels).value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// Gauge 仪表盘
+type Gauge struct {
+	family
+}
+
+// Add 增加 v，v 可以为负
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.mu.Lock()
+	g.get(labels).value += v
+	g.mu.Unlock()
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.mu.Lock()
+	g.get(labels).value = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writeHeader(w)
+	// 没有标签的仪表盘在第一次变化前也输出 0
+	if len(g.labels) == 0 {
+		g.get(nil)
+	}
+	for _, s := range g.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// Histogram 直方图
+type Histogram struct {
+	family
+	buckets []float64
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels), s.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
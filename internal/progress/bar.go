@@ -0,0 +1,189 @@
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/theme"
+)
+
+// plainInterval 非终端输出时纯文本进度行的间隔
+const plainInterval = 10 * time.Second
+
+// barWidth 进度条宽度 (字符)
+const barWidth = 36
+
+// BarReporter 终端进度条
+//
+// 标准输出为终端时用 \r 原地重绘，并在每条日志之后重绘，避免进度条被日志打断；
+// 否则每隔 plainInterval 输出一行纯文本进度。
+type BarReporter struct {
+	interactive bool
+
+	mu     sync.Mutex
+	active bool
+	last   Snapshot
+	// lastPlain 上一次输出纯文本进度行的时间
+	lastPlain time.Time
+}
+
+// NewBar 创建终端进度条报告器
+func NewBar() Reporter {
+	return &BarReporter{interactive: theme.Interactive()}
+}
+
+func (b *BarReporter) Report(event Event) {
+	switch event.Type {
+	case DownloadStarted:
+		b.start()
+	case SegmentSucceeded, SegmentFailed, SegmentSkipped:
+		if event.Progress != nil {
+			b.update(*event.Progress)
+		}
+	case DownloadFinished:
+		b.finish()
+	}
+}
+
+func (b *BarReporter) start() {
+	b.mu.Lock()
+	b.active = true
+	b.last = Snapshot{ETA: -1}
+	b.lastPlain = time.Now()
+	b.mu.Unlock()
+
+	// Register progress redraw so log messages won't leave the progress broken
+	// on the terminal. The logger package will call this after printing logs.
+	if b.interactive {
+		logger.RegisterProgressRedraw(b.redraw)
+	}
+}
+
+func (b *BarReporter) update(s Snapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.active {
+		return
+	}
+	b.last = s
+
+	if b.interactive {
+		b.draw()
+		return
+	}
+
+	// 非终端: 定期输出一行，最后一个段完成时总会输出
+	if s.Done < s.Total && time.Since(b.lastPlain) < plainInterval {
+		return
+	}
+	b.lastPlain = time.Now()
+	fmt.Printf("进度: %d/%d %.2f%% %s %s ETA:%s\n",
+		s.Done, s.Total, s.Percent, sizeProgress(s), formatSpeed(s.Speed), formatETA(s.ETA))
+}
+
+func (b *BarReporter) redraw() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.active {
+		b.draw()
+	}
+}
+
+func (b *BarReporter) finish() {
+	b.mu.Lock()
+	wasActive := b.active
+	b.active = false
+	b.mu.Unlock()
+
+	// stop progress redraw and clear the line so subsequent operations (merge)
+	// won't have the progress bar print over log output.
+	if b.interactive && wasActive {
+		logger.RegisterProgressRedraw(nil)
+		fmt.Print("\r\033[K")
+		fmt.Println()
+	}
+}
+
+// draw 原地重绘进度条，调用方需持有 b.mu
+func (b *BarReporter) draw() {
+	s := b.last
+	if s.Total == 0 {
+		return
+	}
+
+	pos := int(s.Percent / 100 * barWidth)
+	if pos > barWidth {
+		pos = barWidth
+	}
+
+	// spinner
+	sp := []string{"⣽", "⣾", "⣻", "⣷", "⣯", "⣟"}
+	spinner := sp[int(time.Now().UnixNano()/1e8)%len(sp)]
+
+	// render bar with colors using theme
+	filled := ""
+	if pos > 0 {
+		filled = theme.Green + strings.Repeat("━", pos) + theme.Reset
+	}
+	empty := theme.Surface1 + strings.Repeat(" ", barWidth-pos) + theme.Reset
+
+	fmt.Printf("\r%s %s%s %s%d/%d %6.2f%% %s ETA:%s %s%s",
+		theme.Lavender+formatSpeed(s.Speed)+theme.Reset,
+		filled,
+		empty,
+		theme.Text,
+		s.Done,
+		s.Total,
+		s.Percent,
+		sizeProgress(s),
+		formatETA(s.ETA),
+		spinner,
+		theme.Reset,
+	)
+}
+
+// sizeProgress 返回 "已完成大小/预计总大小"
+func sizeProgress(s Snapshot) string {
+	if s.EstimatedBytes == 0 {
+		return formatBytes(s.Bytes)
+	}
+	return formatBytes(s.Bytes) + "/~" + formatBytes(s.EstimatedBytes)
+}
+
+// formatBytes 把字节数格式化为 KB/MB/GB
+func formatBytes(n int64) string {
+	const unit = 1024
+	switch {
+	case n >= unit*unit*unit:
+		return fmt.Sprintf("%.2fGB", float64(n)/(unit*unit*unit))
+	case n >= unit*unit:
+		return fmt.Sprintf("%.1fMB", float64(n)/(unit*unit))
+	default:
+		return fmt.Sprintf("%.0fKB", float64(n)/unit)
+	}
+}
+
+// formatSpeed 把字节/秒格式化为 MB/s
+func formatSpeed(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.2f MB/s", bytesPerSecond/(1024*1024))
+}
+
+// formatETA 把剩余秒数格式化为 hh:mm:ss 或 mm:ss，无法估计 (负数) 时返回 --:--
+func formatETA(seconds float64) string {
+	if seconds < 0 {
+		return "--:--"
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%02dh%02dm%02ds", h, m, s)
+	}
+	return fmt.Sprintf("%02dm%02ds", m, s)
+}
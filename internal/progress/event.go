@@ -0,0 +1,129 @@
+package progress
+
+import (
+	"os"
+	"time"
+)
+
+// 进度输出方式
+const (
+	ModeBar  = "bar"
+	ModeJSON = "json"
+	ModeNone = "none"
+)
+
+// EventType 进度事件类型
+type EventType string
+
+const (
+	ManifestParsed   EventType = "manifest_parsed"
+	DownloadStarted  EventType = "download_started"
+	SegmentStarted   EventType = "segment_started"
+	SegmentSucceeded EventType = "segment_succeeded"
+	SegmentFailed    EventType = "segment_failed"
+	SegmentSkipped   EventType = "segment_skipped"
+	DownloadFinished EventType = "download_finished"
+	MergeStarted     EventType = "merge_started"
+	MergeFinished    EventType = "merge_finished"
+)
+
+// Event 一个进度事件，只有与事件类型相关的字段会被设置
+type Event struct {
+	Type     EventType `json:"event"`
+	Time     time.Time `json:"time"`
+	Manifest *Manifest `json:"manifest,omitempty"`
+	Segment  *Segment  `json:"segment,omitempty"`
+	Merge    *Merge    `json:"merge,omitempty"`
+	Progress *Snapshot `json:"progress,omitempty"`
+	// Error 段下载或合并失败的原因
+	Error string `json:"error,omitempty"`
+	// Job 批量下载时事件所属任务的名称
+	Job string `json:"job,omitempty"`
+}
+
+// Manifest 清单解析完成时的信息
+type Manifest struct {
+	URL      string  `json:"url"`
+	Segments int     `json:"segments"`
+	Duration float64 `json:"duration"`
+	Live     bool    `json:"live,omitempty"`
+}
+
+// Segment 段事件的信息
+type Segment struct {
+	Index    int     `json:"index"`
+	Name     string  `json:"name"`
+	URL      string  `json:"url"`
+	Duration float64 `json:"duration"`
+	// Bytes 写入磁盘的字节数，仅 segment_succeeded 与 segment_skipped
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// Merge 合并事件的信息
+type Merge struct {
+	Merger string `json:"merger"`
+	Output string `json:"output"`
+}
+
+// Snapshot 事件发生时的下载进度
+type Snapshot struct {
+	Total   int64 `json:"total"`
+	Done    int64 `json:"done"`
+	Skipped int64 `json:"skipped"`
+	Failed  int64 `json:"failed"`
+	// Percent 按媒体时长加权的完成百分比 (0-100)
+	Percent float64 `json:"percent"`
+	// Bytes 已完成段的字节数
+	Bytes int64 `json:"bytes"`
+	// EstimatedBytes 预计总大小，无法估算时为 0
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	// Speed 最近几秒的下载速度 (字节/秒)
+	Speed float64 `json:"bytes_per_second"`
+	// ETA 预计剩余秒数，无法估算时为 -1
+	ETA float64 `json:"eta_seconds"`
+}
+
+// Reporter 接收下载过程中的进度事件
+//
+// Report 会被多个下载 goroutine 并发调用，实现需要自行保证并发安全。
+type Reporter interface {
+	Report(event Event)
+}
+
+// New 按输出方式创建进度报告器: bar 为终端进度条 (非终端时定期输出纯文本行)，
+// json 每个事件向标准错误输出一行 JSON，none 不输出
+func New(mode string) Reporter {
+	switch mode {
+	case ModeJSON:
+		return NewJSON(os.Stderr)
+	case ModeNone:
+		return NewSilent()
+	default:
+		return NewBar()
+	}
+}
+
+// WithJob 返回为每个事件填写任务名称后转发给 r 的报告器
+func WithJob(r Reporter, job string) Reporter {
+	return jobReporter{next: r, job: job}
+}
+
+type jobReporter struct {
+	next Reporter
+	job  string
+}
+
+func (r jobReporter) Report(event Event) {
+	event.Job = r.job
+	r.next.Report(event)
+}
+
+// silentReporter 丢弃所有事件
+type silentReporter struct{}
+
+// NewSilent 创建不输出任何内容的进度报告器
+func NewSilent() Reporter {
+	return silentReporter{}
+}
+
+func (silentReporter) Report(Event) {}
@@ -0,0 +1,29 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONReporter 每个事件输出一行 JSON (NDJSON)，供图形界面与脚本解析
+type JSONReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSON 创建输出到 w 的 NDJSON 进度报告器
+func NewJSON(w io.Writer) Reporter {
+	return &JSONReporter{w: w}
+}
+
+func (r *JSONReporter) Report(event Event) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(line, '\n'))
+}
@@ -0,0 +1,84 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJSONReporter 测试每个事件输出一行 JSON
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewJSON(&buf)
+
+	reporter.Report(Event{
+		Type:     ManifestParsed,
+		Time:     time.Now(),
+		Manifest: &Manifest{URL: "https://example.com/index.m3u8", Segments: 3, Duration: 12},
+	})
+	reporter.Report(Event{
+		Type:     SegmentFailed,
+		Time:     time.Now(),
+		Segment:  &Segment{Index: 0, Name: "00000.ts", Duration: 4},
+		Progress: &Snapshot{Total: 3, Failed: 1, ETA: -1},
+		Error:    "timeout",
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("期望 2 行, 得到 %q", buf.String())
+	}
+
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("第一行不是合法 JSON: %v", err)
+	}
+	if first["event"] != "manifest_parsed" || first["segment"] != nil || first["progress"] != nil {
+		t.Errorf("第一行内容错误: %v", first)
+	}
+
+	var second Event
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("第二行不是合法 JSON: %v", err)
+	}
+	if second.Type != SegmentFailed || second.Error != "timeout" || second.Segment == nil || second.Segment.Index != 0 {
+		t.Errorf("第二行内容错误: %+v", second)
+	}
+	if second.Progress == nil || second.Progress.Failed != 1 || second.Progress.ETA != -1 {
+		t.Errorf("进度快照错误: %+v", second.Progress)
+	}
+}
+
+// TestNew 测试按输出方式选择报告器
+func TestNew(t *testing.T) {
+	if _, ok := New(ModeJSON).(*JSONReporter); !ok {
+		t.Error("json 应创建 JSONReporter")
+	}
+	if _, ok := New(ModeBar).(*BarReporter); !ok {
+		t.Error("bar 应创建 BarReporter")
+	}
+	if _, ok := New(ModeNone).(silentReporter); !ok {
+		t.Error("none 应创建静默报告器")
+	}
+}
+
+// TestFormatProgress 测试进度条中大小与时间的格式
+func TestFormatProgress(t *testing.T) {
+	tests := []struct{ got, want string }{
+		{formatBytes(512 << 10), "512KB"},
+		{formatBytes(15<<20 + 300<<10), "15.3MB"},
+		{formatBytes(3 << 30), "3.00GB"},
+		{formatSpeed(2.5 * (1 << 20)), "2.50 MB/s"},
+		{formatETA(5405), "01h30m05s"},
+		{formatETA(75), "01m15s"},
+		{formatETA(-1), "--:--"},
+		{sizeProgress(Snapshot{Bytes: 1 << 20, EstimatedBytes: 4 << 20}), "1.0MB/~4.0MB"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("期望 %s, 得到 %s", tt.want, tt.got)
+		}
+	}
+}
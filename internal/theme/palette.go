@@ -1,8 +1,9 @@
 package theme
 
 // Catppuccin Mocha ANSI colors
-// Values are ANSI escape sequences for 24-bit colors
-const (
+// Values are ANSI escape sequences for 24-bit colors, cleared by Configure
+// when colors are disabled.
+var (
 	Reset = "\033[0m"
 
 	Text     = "\033[38;2;205;214;244m"
@@ -0,0 +1,39 @@
+package theme
+
+import "os"
+
+// interactive 标准输出是否为终端，在启动时检测一次
+var interactive = IsTerminal(os.Stdout)
+
+// IsTerminal 判断文件是否为终端
+//
+// 标准库没有 isatty，这里按字符设备近似判断: 重定向到 /dev/null 等其他字符设备时
+// 同样返回 true，此时颜色与 \r 重绘输出到这些设备不会造成问题。
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Interactive 标准输出是否为终端，为 false 时不应输出 \r 重绘
+func Interactive() bool {
+	return interactive
+}
+
+// Configure 按输出环境决定是否使用颜色，须在产生任何输出之前调用
+//
+// 以下情况关闭颜色: noColor 为 true、设置了 NO_COLOR 环境变量 (https://no-color.org)、
+// 标准输出不是终端。
+func Configure(noColor bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" || !interactive {
+		disable()
+	}
+}
+
+func disable() {
+	Reset = ""
+	Text, Subtext1, Surface1 = "", "", ""
+	Sky, Green, Yellow, Red, Maroon, Lavender = "", "", "", "", "", ""
+}
@@ -0,0 +1,85 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveState 保存颜色、终端检测结果与 NO_COLOR，测试结束时恢复
+func saveState(t *testing.T) {
+	palette := []*string{&Reset, &Text, &Subtext1, &Surface1, &Sky, &Green, &Yellow, &Red, &Maroon, &Lavender}
+	saved := make([]string, len(palette))
+	for i, color := range palette {
+		saved[i] = *color
+	}
+	savedInteractive := interactive
+	noColor, hadNoColor := os.LookupEnv("NO_COLOR")
+
+	t.Cleanup(func() {
+		for i, color := range palette {
+			*color = saved[i]
+		}
+		interactive = savedInteractive
+		if hadNoColor {
+			os.Setenv("NO_COLOR", noColor)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	})
+}
+
+// TestConfigure 测试 -no-color、NO_COLOR 与非终端输出关闭颜色，终端输出保留颜色
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name        string
+		noColor     bool
+		env         string
+		interactive bool
+		colored     bool
+	}{
+		{"终端", false, "", true, true},
+		{"-no-color", true, "", true, false},
+		{"NO_COLOR", false, "1", true, false},
+		{"非终端", false, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveState(t)
+			interactive = tt.interactive
+			if tt.env != "" {
+				os.Setenv("NO_COLOR", tt.env)
+			} else {
+				os.Unsetenv("NO_COLOR")
+			}
+
+			Configure(tt.noColor)
+			if colored := Reset != "" && Red != ""; colored != tt.colored {
+				t.Errorf("期望颜色 %v, 得到 %v", tt.colored, colored)
+			}
+		})
+	}
+}
+
+// TestIsTerminal 测试普通文件与管道不被当作终端
+func TestIsTerminal(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if IsTerminal(file) {
+		t.Error("普通文件不应被当作终端")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(w) {
+		t.Error("管道不应被当作终端")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"crypto/cipher"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"m3u8-downloader/internal/errors"
 )
@@ -60,6 +62,76 @@ func WriteFile(path string, data []byte) error {
 	return nil
 }
 
+// PartSuffix 写入中的临时文件后缀
+const PartSuffix = ".part"
+
+// WriteFileAtomic 先写入 path.part 并 fsync，校验大小后重命名为 path
+//
+// 进程在任意时刻被中断都不会在 path 留下不完整的文件，残留的 .part 文件
+// 由 RemovePartFiles 清理。
+func WriteFileAtomic(path string, data []byte) error {
+	return WriteFileAtomicMode(path, data, 0666)
+}
+
+// WriteFileAtomicMode 与 WriteFileAtomic 相同，文件权限为 perm (受 umask 影响)
+func WriteFileAtomicMode(path string, data []byte, perm os.FileMode) error {
+	partPath := path + PartSuffix
+
+	// 先删除可能残留的 .part 文件，保证新建的文件使用 perm
+	os.Remove(partPath)
+	f, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return errors.New(errors.FileWrite, fmt.Sprintf("创建文件失败: %s", partPath), err)
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return errors.New(errors.FileWrite, fmt.Sprintf("写入文件失败: %s", partPath), err)
+	}
+
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() != int64(len(data)) {
+		os.Remove(partPath)
+		return errors.New(errors.FileWrite, fmt.Sprintf("写入文件大小不一致: %s", partPath), err)
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		os.Remove(partPath)
+		return errors.New(errors.FileWrite, fmt.Sprintf("重命名文件失败: %s", partPath), err)
+	}
+	return nil
+}
+
+// RemovePartFiles 删除目录中上次运行残留的 .part 文件，返回删除的数量
+func RemovePartFiles(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.New(errors.FileRead, "读取目录失败", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), PartSuffix) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return removed, errors.New(errors.FileWrite, "删除临时文件失败", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
 // GetFileSize 获取文件大小（单位：MB）
 func GetFileSize(path string) (float64, error) {
 	info, err := os.Stat(path)
@@ -69,11 +141,6 @@ func GetFileSize(path string) (float64, error) {
 	return float64(info.Size()) / (1024 * 1024), nil
 }
 
-// RemoveDir 删除目录
-func RemoveDir(path string) error {
-	return os.RemoveAll(path)
-}
-
 // ============ 加解密操作 ============
 
 // PKCS7Padding PKCS7 填充
@@ -123,12 +190,18 @@ func AesDecrypt(crypted, key []byte, ivs ...[]byte) ([]byte, error) {
 		return nil, err
 	}
 	blockSize := block.BlockSize()
+	if len(crypted) == 0 || len(crypted)%blockSize != 0 {
+		return nil, fmt.Errorf("密文长度 %d 不是块大小 %d 的整数倍", len(crypted), blockSize)
+	}
 	var iv []byte
 	if len(ivs) == 0 {
 		iv = key
 	} else {
 		iv = ivs[0]
 	}
+	if len(iv) < blockSize {
+		return nil, fmt.Errorf("IV 长度 %d 小于块大小 %d", len(iv), blockSize)
+	}
 	blockMode := cipher.NewCBCDecrypter(block, iv[:blockSize])
 	origData := make([]byte, len(crypted))
 	blockMode.CryptBlocks(origData, crypted)
@@ -141,6 +214,8 @@ func AesDecrypt(crypted, key []byte, ivs ...[]byte) ([]byte, error) {
 const (
 	// SyncByte TS 同步字节
 	SyncByte = uint8(0x47) // 71 in decimal
+	// TSPacketSize MPEG-TS 包长度
+	TSPacketSize = 188
 )
 
 // RemoveTSPadding 移除 TS 文件前的填充字节
@@ -155,6 +230,36 @@ func RemoveTSPadding(data []byte) []byte {
 
 // ============ URL 处理 ============
 
+// MatchHost 检查主机名是否匹配模式，*.example.com 同时匹配 example.com 本身
+func MatchHost(pattern, host string) bool {
+	if ok, _ := path.Match(pattern, host); ok {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return host == pattern[2:]
+	}
+	return false
+}
+
+// ValidateTS 检查数据是否为完整的 MPEG-TS: 非空，长度是 188 字节的整数倍，
+// 且每个包都以同步字节开头
+func ValidateTS(data []byte) error {
+	if len(data) == 0 {
+		return errors.New(errors.DownloadFailed, "段数据为空", nil)
+	}
+	if rest := len(data) % TSPacketSize; rest != 0 {
+		return errors.New(errors.DownloadFailed,
+			fmt.Sprintf("段长度 %d 不是 %d 的整数倍，最后一个包不完整 (%d 字节)", len(data), TSPacketSize, rest), nil)
+	}
+	for i := 0; i < len(data); i += TSPacketSize {
+		if data[i] != SyncByte {
+			return errors.New(errors.DownloadFailed,
+				fmt.Sprintf("偏移 %d 处缺少 TS 同步字节 (0x%02x)", i, data[i]), nil)
+		}
+	}
+	return nil
+}
+
 // ListTSFiles 列出目录中的所有 TS 文件
 func ListTSFiles(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+
+	"m3u8-downloader/internal/errors"
+)
+
+// TestValidateTS 测试空数据、不完整的最后一个包与错误的同步字节被拒绝
+func TestValidateTS(t *testing.T) {
+	packet := append([]byte{SyncByte}, bytes.Repeat([]byte{0xff}, TSPacketSize-1)...)
+	badSync := append(append([]byte{}, packet...), bytes.Repeat([]byte{0xff}, TSPacketSize)...)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"空数据", nil, false},
+		{"最后一个包不完整", append(bytes.Repeat(packet, 2), packet[:100]...), false},
+		{"同步字节错误", badSync, false},
+		{"完整的段", bytes.Repeat(packet, 3), true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateTS(tt.data)
+		if tt.valid && err != nil {
+			t.Errorf("%s: 期望通过, 得到 %v", tt.name, err)
+		}
+		if !tt.valid && !errors.IsCode(err, errors.DownloadFailed) {
+			t.Errorf("%s: 期望 %s 错误, 得到 %v", tt.name, errors.DownloadFailed, err)
+		}
+	}
+}
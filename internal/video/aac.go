@@ -0,0 +1,90 @@
+package video
+
+import "fmt"
+
+// aacFrameSamples 每个 AAC 帧包含的采样数
+const aacFrameSamples = 1024
+
+var aacSampleRates = []uint32{
+	96000, 88200, 64000, 48000, 44100, 32000,
+	24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// adtsHeader ADTS 帧头中封装 MP4 需要的字段
+type adtsHeader struct {
+	objectType   byte
+	rateIndex    byte
+	channels     byte
+	headerLength int
+	frameLength  int
+}
+
+func (h *adtsHeader) sampleRate() uint32 {
+	return aacSampleRates[h.rateIndex]
+}
+
+// parseADTS 解析 ADTS 帧头 (7 字节，带 CRC 时为 9 字节)
+func parseADTS(data []byte) (*adtsHeader, error) {
+	if len(data) < 7 || data[0] != 0xFF || data[1]&0xF6 != 0xF0 {
+		return nil, fmt.Errorf("无效的 ADTS 同步字")
+	}
+
+	h := &adtsHeader{
+		objectType:   (data[2]>>6)&0x03 + 1,
+		rateIndex:    (data[2] >> 2) & 0x0F,
+		channels:     (data[2]&0x01)<<2 | data[3]>>6,
+		headerLength: 7,
+		frameLength:  int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5),
+	}
+	if data[1]&0x01 == 0 {
+		h.headerLength = 9
+	}
+
+	if int(h.rateIndex) >= len(aacSampleRates) {
+		return nil, fmt.Errorf("无效的 AAC 采样率索引: %d", h.rateIndex)
+	}
+	if h.frameLength <= h.headerLength {
+		return nil, fmt.Errorf("无效的 ADTS 帧长度: %d", h.frameLength)
+	}
+
+	return h, nil
+}
+
+// aacSampleEntry 生成 mp4a 样本描述 (包含 esds)
+func aacSampleEntry(h *adtsHeader) []byte {
+	// AudioSpecificConfig: object type (5) + frequency index (4) + channel config (4)
+	asc := uint16(h.objectType)<<11 | uint16(h.rateIndex)<<7 | uint16(h.channels)<<3
+
+	decoderSpecific := descriptor(0x05, pack(asc))
+	decoderConfig := descriptor(0x04, pack(
+		uint8(0x40),         // MPEG-4 Audio
+		uint8(0x15),         // AudioStream
+		uint8(0), uint16(0), // bufferSizeDB
+		uint32(0), uint32(0), // maxBitrate, avgBitrate
+		decoderSpecific,
+	))
+	es := descriptor(0x03, pack(
+		uint16(0), uint8(0), // ES_ID, flags
+		decoderConfig,
+		descriptor(0x06, pack(uint8(0x02))), // SLConfigDescriptor
+	))
+
+	// samplerate 为 16.16 定点数，超出范围时填 0，以 mdhd 时间刻度为准
+	rate := h.sampleRate()
+	if rate > 0xFFFF {
+		rate = 0
+	}
+
+	return box("mp4a", pack(
+		make([]byte, 6), uint16(1), // reserved, data_reference_index
+		uint32(0), uint32(0),
+		uint16(h.channels), uint16(16), // channelcount, samplesize
+		uint16(0), uint16(0),
+		rate<<16,
+	), fullBox("esds", 0, 0, es))
+}
+
+// descriptor 生成 MPEG-4 描述符 (长度均小于 128 字节)
+func descriptor(tag byte, payload []byte) []byte {
+	return append([]byte{tag, byte(len(payload))}, payload...)
+}
@@ -0,0 +1,118 @@
+package video
+
+import "fmt"
+
+// bitReader 按位读取 RBSP 数据 (已去除防竞争字节)
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (r *bitReader) u(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			if r.err == nil {
+				r.err = fmt.Errorf("数据不足: 需要 %d 位", n)
+			}
+			return 0
+		}
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.u(1) == 1
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+	if r.pos > len(r.data)*8 && r.err == nil {
+		r.err = fmt.Errorf("数据不足: 跳过 %d 位", n)
+	}
+}
+
+// ue 读取无符号指数哥伦布编码
+func (r *bitReader) ue() uint64 {
+	zeros := 0
+	for !r.flag() {
+		if r.err != nil || zeros > 32 {
+			if r.err == nil {
+				r.err = fmt.Errorf("指数哥伦布编码无效")
+			}
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.u(zeros)
+}
+
+// se 读取有符号指数哥伦布编码
+func (r *bitReader) se() int64 {
+	v := r.ue()
+	if v%2 == 1 {
+		return int64((v + 1) / 2)
+	}
+	return -int64(v / 2)
+}
+
+// unescapeRBSP 去除 NAL 负载中的防竞争字节 (00 00 03 -> 00 00)
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// splitNALUnits 按起始码拆分 Annex B 字节流
+func splitNALUnits(data []byte) [][]byte {
+	var nals [][]byte
+
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = appendNAL(nals, data[start:i])
+		}
+		i += 2
+		start = i + 1
+	}
+
+	if start >= 0 && start < len(data) {
+		nals = appendNAL(nals, data[start:])
+	}
+
+	return nals
+}
+
+// appendNAL 去掉四字节起始码留下的尾部零字节后追加
+func appendNAL(nals [][]byte, nal []byte) [][]byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
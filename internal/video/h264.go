@@ -0,0 +1,167 @@
+package video
+
+// H.264 NAL 单元类型
+const (
+	h264NALIDR = 5
+	h264NALSPS = 7
+	h264NALPPS = 8
+	h264NALAUD = 9
+)
+
+// h264SPS H.264 序列参数集中封装 MP4 需要的字段
+type h264SPS struct {
+	profile        byte
+	compatibility  byte
+	level          byte
+	chromaFormat   uint64
+	bitDepthLuma   uint64
+	bitDepthChroma uint64
+	width          int
+	height         int
+}
+
+// parseH264SPS 解析 SPS，得到编码档次与裁剪后的画面尺寸
+func parseH264SPS(nal []byte) (*h264SPS, error) {
+	r := newBitReader(unescapeRBSP(nal[1:]))
+
+	sps := &h264SPS{
+		profile:        byte(r.u(8)),
+		compatibility:  byte(r.u(8)),
+		level:          byte(r.u(8)),
+		chromaFormat:   1,
+		bitDepthLuma:   8,
+		bitDepthChroma: 8,
+	}
+	r.ue() // seq_parameter_set_id
+
+	separateColourPlane := false
+	switch sps.profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.chromaFormat = r.ue()
+		if sps.chromaFormat == 3 {
+			separateColourPlane = r.flag()
+		}
+		sps.bitDepthLuma = r.ue() + 8
+		sps.bitDepthChroma = r.ue() + 8
+		r.skip(1)     // qpprime_y_zero_transform_bypass_flag
+		if r.flag() { // seq_scaling_matrix_present_flag
+			lists := 8
+			if sps.chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.flag() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(r, size)
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skip(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		n := r.ue()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			r.se()
+		}
+	}
+
+	r.ue()    // max_num_ref_frames
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := r.ue() + 1
+	heightInMapUnits := r.ue() + 1
+	frameMbsOnly := r.flag()
+	if !frameMbsOnly {
+		r.skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.skip(1) // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint64
+	if r.flag() {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	frameHeightFactor := uint64(2)
+	if frameMbsOnly {
+		frameHeightFactor = 1
+	}
+
+	cropUnitX, cropUnitY := uint64(1), frameHeightFactor
+	if !separateColourPlane && sps.chromaFormat != 0 {
+		subWidth, subHeight := uint64(2), uint64(2)
+		switch sps.chromaFormat {
+		case 2:
+			subHeight = 1
+		case 3:
+			subWidth, subHeight = 1, 1
+		}
+		cropUnitX, cropUnitY = subWidth, subHeight*frameHeightFactor
+	}
+
+	sps.width = int(widthInMbs*16 - cropUnitX*(cropLeft+cropRight))
+	sps.height = int(frameHeightFactor*heightInMapUnits*16 - cropUnitY*(cropTop+cropBottom))
+
+	return sps, nil
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := int64(8), int64(8)
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// h264SampleEntry 生成 avc1 样本描述 (包含 avcC)
+func h264SampleEntry(sps *h264SPS, spsNAL, ppsNAL []byte) []byte {
+	avcC := pack(
+		uint8(1), sps.profile, sps.compatibility, sps.level,
+		uint8(0xFF), // lengthSizeMinusOne = 3
+		uint8(0xE1), uint16(len(spsNAL)), spsNAL,
+		uint8(1), uint16(len(ppsNAL)), ppsNAL,
+	)
+
+	// High 及以上档次附带色度与位深信息
+	switch sps.profile {
+	case 100, 110, 122, 144:
+		avcC = append(avcC, pack(
+			uint8(0xFC|sps.chromaFormat),
+			uint8(0xF8|(sps.bitDepthLuma-8)),
+			uint8(0xF8|(sps.bitDepthChroma-8)),
+			uint8(0),
+		)...)
+	}
+
+	return visualSampleEntry("avc1", sps.width, sps.height, box("avcC", avcC))
+}
+
+// visualSampleEntry 生成视频样本描述的公共部分
+func visualSampleEntry(typ string, width, height int, config []byte) []byte {
+	return box(typ, pack(
+		make([]byte, 6), uint16(1), // reserved, data_reference_index
+		uint16(0), uint16(0), make([]byte, 12),
+		uint16(width), uint16(height),
+		uint32(0x00480000), uint32(0x00480000), // 72 dpi
+		uint32(0), uint16(1), // reserved, frame_count
+		make([]byte, 32), // compressorname
+		uint16(0x0018), int16(-1),
+	), config)
+}
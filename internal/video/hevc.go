@@ -0,0 +1,133 @@
+package video
+
+// HEVC NAL 单元类型
+const (
+	hevcNALVPS = 32
+	hevcNALSPS = 33
+	hevcNALPPS = 34
+	hevcNALAUD = 35
+)
+
+// hevcNALType 返回 HEVC NAL 单元类型 (两字节 NAL 头)
+func hevcNALType(nal []byte) int {
+	return int(nal[0]>>1) & 0x3F
+}
+
+// hevcKeyframe 判断是否为 IRAP 图像 (BLA/IDR/CRA)
+func hevcKeyframe(nalType int) bool {
+	return nalType >= 16 && nalType <= 23
+}
+
+// hevcSPS HEVC 序列参数集中封装 MP4 需要的字段
+type hevcSPS struct {
+	// profileTierLevel general_profile_space 到 general_level_idc 的 12 字节原样拷贝
+	profileTierLevel [12]byte
+	maxSubLayers     uint64
+	temporalIDNested bool
+	chromaFormat     uint64
+	bitDepthLuma     uint64
+	bitDepthChroma   uint64
+	width            int
+	height           int
+}
+
+// parseHEVCSPS 解析 SPS，得到编码档次与裁剪后的画面尺寸
+func parseHEVCSPS(nal []byte) (*hevcSPS, error) {
+	rbsp := unescapeRBSP(nal[2:])
+	r := newBitReader(rbsp)
+
+	sps := &hevcSPS{}
+	r.skip(4) // sps_video_parameter_set_id
+	sps.maxSubLayers = r.u(3) + 1
+	sps.temporalIDNested = r.flag()
+
+	// general_profile_tier_level 共 12 字节，起始于字节边界
+	if len(rbsp) >= 13 {
+		copy(sps.profileTierLevel[:], rbsp[1:13])
+	}
+	r.skip(96)
+
+	subLayers := int(sps.maxSubLayers - 1)
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.flag()
+		levelPresent[i] = r.flag()
+	}
+	if subLayers > 0 {
+		r.skip(2 * (8 - subLayers)) // reserved_zero_2bits
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.skip(88)
+		}
+		if levelPresent[i] {
+			r.skip(8)
+		}
+	}
+
+	r.ue() // sps_seq_parameter_set_id
+	sps.chromaFormat = r.ue()
+	separateColourPlane := false
+	if sps.chromaFormat == 3 {
+		separateColourPlane = r.flag()
+	}
+	width := r.ue()
+	height := r.ue()
+
+	var cropLeft, cropRight, cropTop, cropBottom uint64
+	if r.flag() { // conformance_window_flag
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	sps.bitDepthLuma = r.ue() + 8
+	sps.bitDepthChroma = r.ue() + 8
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	subWidth, subHeight := uint64(1), uint64(1)
+	if !separateColourPlane {
+		switch sps.chromaFormat {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+	}
+
+	sps.width = int(width - subWidth*(cropLeft+cropRight))
+	sps.height = int(height - subHeight*(cropTop+cropBottom))
+
+	return sps, nil
+}
+
+// hevcSampleEntry 生成 hvc1 样本描述 (包含 hvcC)
+func hevcSampleEntry(sps *hevcSPS, vps, spsNAL, pps []byte) []byte {
+	nested := uint8(0)
+	if sps.temporalIDNested {
+		nested = 1
+	}
+
+	hvcC := pack(
+		uint8(1), sps.profileTierLevel[:],
+		uint16(0xF000), // min_spatial_segmentation_idc
+		uint8(0xFC),    // parallelismType
+		uint8(0xFC|sps.chromaFormat),
+		uint8(0xF8|(sps.bitDepthLuma-8)),
+		uint8(0xF8|(sps.bitDepthChroma-8)),
+		uint16(0),                                 // avgFrameRate
+		uint8(sps.maxSubLayers<<3)|nested<<2|0x03, // lengthSizeMinusOne = 3
+		uint8(3),
+	)
+
+	// 参数集以 hvc1 方式全部放在样本描述中
+	for _, ps := range []struct {
+		typ int
+		nal []byte
+	}{{hevcNALVPS, vps}, {hevcNALSPS, spsNAL}, {hevcNALPPS, pps}} {
+		hvcC = append(hvcC, pack(uint8(0x80|ps.typ), uint16(1), uint16(len(ps.nal)), ps.nal)...)
+	}
+
+	return visualSampleEntry("hvc1", sps.width, sps.height, box("hvcC", hvcC))
+}
@@ -23,6 +23,7 @@ type Merger interface {
 // FFmpegMerger FFmpeg 视频合并实现
 type FFmpegMerger struct {
 	ffmpegPath string
+	options    []string
 	logger     logger.Logger
 }
 
@@ -33,10 +34,18 @@ func NewFFmpegMerger(ffmpegPath string, logger logger.Logger) *FFmpegMerger {
 	}
 	return &FFmpegMerger{
 		ffmpegPath: ffmpegPath,
+		options:    []string{"-c", "copy", "-y"},
 		logger:     logger,
 	}
 }
 
+// SetOptions 设置输入与输出文件之间的 FFmpeg 参数，为空时保持默认的 -c copy -y
+func (m *FFmpegMerger) SetOptions(options []string) {
+	if len(options) > 0 {
+		m.options = options
+	}
+}
+
 // CheckFFmpeg 检查 FFmpeg 是否可用
 func (m *FFmpegMerger) CheckFFmpeg() error {
 	cmd := exec.Command(m.ffmpegPath, "-version")
@@ -84,15 +93,14 @@ func (m *FFmpegMerger) Merge(segmentDir, outputPath string) (string, error) {
 	m.logger.Info("开始合并 %d 个 TS 文件到 %s", len(tsFiles), theme.Lavender+outputPath+theme.Reset)
 
 	// 执行 FFmpeg 合并
-	cmd := exec.Command(
-		m.ffmpegPath,
+	args := []string{
 		"-f", "concat",
 		"-safe", "0",
 		"-i", concatFile,
-		"-c", "copy",
-		"-y",
-		outputPath,
-	)
+	}
+	args = append(args, m.options...)
+	args = append(args, outputPath)
+	cmd := exec.Command(m.ffmpegPath, args...)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -118,6 +126,11 @@ func (m *FFmpegMerger) Merge(segmentDir, outputPath string) (string, error) {
 
 // Validate 验证输出文件
 func (m *FFmpegMerger) Validate(outputPath string) error {
+	return validateOutput(outputPath)
+}
+
+// validateOutput 检查输出文件存在且不为空
+func validateOutput(outputPath string) error {
 	exists, err := util.PathExists(outputPath)
 	if err != nil {
 		return err
@@ -138,3 +151,35 @@ func (m *FFmpegMerger) Validate(outputPath string) error {
 
 	return nil
 }
+
+// FallbackMerger 主合并器失败时改用备用合并器
+type FallbackMerger struct {
+	primary  Merger
+	fallback Merger
+	logger   logger.Logger
+}
+
+// NewFallbackMerger 创建带备用方案的合并器
+func NewFallbackMerger(primary, fallback Merger, logger logger.Logger) *FallbackMerger {
+	return &FallbackMerger{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+	}
+}
+
+// Merge 先使用主合并器，失败后使用备用合并器
+func (m *FallbackMerger) Merge(segmentDir, outputPath string) (string, error) {
+	output, err := m.primary.Merge(segmentDir, outputPath)
+	if err == nil {
+		return output, nil
+	}
+
+	m.logger.Warn("合并失败，改用备用方式: %v", err)
+	return m.fallback.Merge(segmentDir, outputPath)
+}
+
+// Validate 验证输出文件
+func (m *FallbackMerger) Validate(outputPath string) error {
+	return validateOutput(outputPath)
+}
@@ -0,0 +1,398 @@
+package video
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+)
+
+// movieTimescale mvhd 与 elst 使用的时间刻度 (毫秒)
+const movieTimescale = 1000
+
+// pack 按大端序拼接字段，支持 uint8/16/32/64、int16/32/64、[]byte 和 string
+func pack(values ...interface{}) []byte {
+	var out []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case uint8:
+			out = append(out, v)
+		case uint16:
+			out = append(out, byte(v>>8), byte(v))
+		case uint32:
+			out = appendUint32(out, v)
+		case uint64:
+			out = appendUint64(out, v)
+		case int16:
+			out = append(out, byte(uint16(v)>>8), byte(v))
+		case int32:
+			out = appendUint32(out, uint32(v))
+		case int64:
+			out = appendUint64(out, uint64(v))
+		case []byte:
+			out = append(out, v...)
+		case string:
+			out = append(out, v...)
+		default:
+			panic(fmt.Sprintf("pack: 不支持的类型 %T", v))
+		}
+	}
+	return out
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+// box 构造一个 MP4 box
+func box(typ string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+
+	out := make([]byte, 0, size)
+	out = appendUint32(out, uint32(size))
+	out = append(out, typ...)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// fullBox 构造带 version 和 flags 的 MP4 box
+func fullBox(typ string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, parts...)...)
+}
+
+// unityMatrix tkhd/mvhd 中的单位变换矩阵
+var unityMatrix = pack(
+	uint32(0x00010000), uint32(0), uint32(0),
+	uint32(0), uint32(0x00010000), uint32(0),
+	uint32(0), uint32(0), uint32(0x40000000),
+)
+
+// mp4Sample 一个媒体样本在 mdat 中的位置与时间信息
+type mp4Sample struct {
+	size uint32
+	// dts 解码时间，单位为轨道时间刻度
+	dts int64
+	// cts 显示时间相对解码时间的偏移
+	cts  int32
+	sync bool
+}
+
+// mp4Chunk 连续存放的同一轨道样本
+type mp4Chunk struct {
+	offset uint64
+	count  uint32
+}
+
+// mp4Track 一个音频或视频轨道
+type mp4Track struct {
+	id          uint32
+	handler     string // vide 或 soun
+	timescale   uint32
+	sampleEntry []byte
+	width       int
+	height      int
+
+	samples []mp4Sample
+	chunks  []mp4Chunk
+
+	// startPTS 第一个显示时间 (90kHz)，用于生成对齐各轨道的编辑列表
+	startPTS int64
+	// defaultDuration 最后一个样本的时长 (无法从下一个样本推算时使用)
+	defaultDuration uint32
+}
+
+// mp4Muxer 流式写入渐进式 MP4: ftyp + mdat (边解析边写入) + moov (末尾)
+type mp4Muxer struct {
+	file      *os.File
+	w         *bufio.Writer
+	offset    uint64
+	mdatStart uint64
+	tracks    []*mp4Track
+	last      *mp4Track
+}
+
+func newMP4Muxer(file *os.File) (*mp4Muxer, error) {
+	m := &mp4Muxer{
+		file: file,
+		w:    bufio.NewWriterSize(file, 1<<20),
+	}
+
+	ftyp := box("ftyp", pack("isom", uint32(0x200), "isom", "iso2", "avc1", "mp41"))
+	if err := m.write(ftyp); err != nil {
+		return nil, err
+	}
+
+	// mdat 使用 64 位长度，写完样本后回填
+	m.mdatStart = m.offset
+	if err := m.write(pack(uint32(1), "mdat", uint64(0))); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *mp4Muxer) write(data []byte) error {
+	n, err := m.w.Write(data)
+	m.offset += uint64(n)
+	return err
+}
+
+// addTrack 添加轨道，轨道 ID 按添加顺序分配
+func (m *mp4Muxer) addTrack(t *mp4Track) {
+	t.id = uint32(len(m.tracks) + 1)
+	m.tracks = append(m.tracks, t)
+}
+
+// writeSample 写入一个样本，同一轨道连续写入的样本合并为一个 chunk
+func (m *mp4Muxer) writeSample(t *mp4Track, data []byte, dts int64, cts int32, sync bool) error {
+	if m.last == t && len(t.chunks) > 0 {
+		t.chunks[len(t.chunks)-1].count++
+	} else {
+		t.chunks = append(t.chunks, mp4Chunk{offset: m.offset, count: 1})
+	}
+	m.last = t
+
+	t.samples = append(t.samples, mp4Sample{
+		size: uint32(len(data)),
+		dts:  dts,
+		cts:  cts,
+		sync: sync,
+	})
+
+	return m.write(data)
+}
+
+// finish 回填 mdat 长度并写入 moov
+func (m *mp4Muxer) finish() error {
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+
+	mdatSize := m.offset - m.mdatStart
+	if _, err := m.file.WriteAt(pack(mdatSize), int64(m.mdatStart+8)); err != nil {
+		return err
+	}
+
+	if err := m.write(m.moov()); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
+
+func (m *mp4Muxer) moov() []byte {
+	// 所有轨道中最早的显示时间作为影片起点
+	globalStart := int64(math.MaxInt64)
+	for _, t := range m.tracks {
+		if len(t.samples) > 0 && t.startPTS < globalStart {
+			globalStart = t.startPTS
+		}
+	}
+
+	var traks [][]byte
+	var movieDuration uint64
+	for _, t := range m.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+		trak, duration := t.trak(globalStart)
+		traks = append(traks, trak)
+		if duration > movieDuration {
+			movieDuration = duration
+		}
+	}
+
+	mvhd := fullBox("mvhd", 1, 0, pack(
+		uint64(0), uint64(0), uint32(movieTimescale), movieDuration,
+		uint32(0x00010000), uint16(0x0100), uint16(0), uint32(0), uint32(0),
+		unityMatrix,
+		make([]byte, 24),
+		uint32(len(m.tracks)+1),
+	))
+
+	return box("moov", append([][]byte{mvhd}, traks...)...)
+}
+
+// durations 返回每个样本的时长 (由相邻样本的 DTS 差得到)
+func (t *mp4Track) durations() []uint32 {
+	durations := make([]uint32, len(t.samples))
+	for i := range t.samples {
+		d := t.defaultDuration
+		if i+1 < len(t.samples) {
+			if diff := t.samples[i+1].dts - t.samples[i].dts; diff > 0 && diff <= math.MaxUint32 {
+				d = uint32(diff)
+			}
+		} else if i > 0 {
+			d = durations[i-1]
+		}
+		durations[i] = d
+	}
+	return durations
+}
+
+// trak 生成轨道 box，返回 box 与以影片时间刻度计的时长
+func (t *mp4Track) trak(globalStart int64) ([]byte, uint64) {
+	durations := t.durations()
+
+	var mediaDuration uint64
+	for _, d := range durations {
+		mediaDuration += uint64(d)
+	}
+
+	// 编辑列表: 轨道晚于影片起点时插入空编辑；视频跳过首帧的显示偏移
+	var mediaTime int64
+	minCTS := int64(math.MaxInt64)
+	for _, s := range t.samples {
+		if pts := s.dts + int64(s.cts); pts < minCTS {
+			minCTS = pts
+		}
+	}
+	mediaTime = minCTS - t.samples[0].dts
+
+	delay := uint64(0)
+	if t.startPTS > globalStart {
+		delay = uint64(t.startPTS-globalStart) * movieTimescale / 90000
+	}
+	editDuration := uint64(0)
+	if mediaDuration > uint64(mediaTime) {
+		editDuration = (mediaDuration - uint64(mediaTime)) * movieTimescale / uint64(t.timescale)
+	}
+
+	var entries [][]byte
+	if delay > 0 {
+		entries = append(entries, pack(delay, int64(-1), uint32(0x00010000)))
+	}
+	entries = append(entries, pack(editDuration, mediaTime, uint32(0x00010000)))
+	elst := fullBox("elst", 1, 0, append([][]byte{pack(uint32(len(entries)))}, entries...)...)
+
+	trackDuration := delay + editDuration
+
+	volume := uint16(0)
+	if t.handler == "soun" {
+		volume = 0x0100
+	}
+	tkhd := fullBox("tkhd", 1, 0x000003, pack(
+		uint64(0), uint64(0), t.id, uint32(0), trackDuration,
+		uint64(0), int16(0), int16(0), volume, uint16(0),
+		unityMatrix,
+		uint32(t.width)<<16, uint32(t.height)<<16,
+	))
+
+	mdhd := fullBox("mdhd", 1, 0, pack(
+		uint64(0), uint64(0), t.timescale, mediaDuration,
+		uint16(0x55C4), uint16(0), // language: und
+	))
+
+	handlerName := "VideoHandler"
+	mediaHeader := fullBox("vmhd", 0, 1, make([]byte, 8))
+	if t.handler == "soun" {
+		handlerName = "SoundHandler"
+		mediaHeader = fullBox("smhd", 0, 0, make([]byte, 4))
+	}
+	hdlr := fullBox("hdlr", 0, 0, pack(uint32(0), t.handler, make([]byte, 12), handlerName, uint8(0)))
+
+	dinf := box("dinf", fullBox("dref", 0, 0, pack(uint32(1)), fullBox("url ", 0, 1)))
+
+	minf := box("minf", mediaHeader, dinf, t.stbl(durations))
+	mdia := box("mdia", mdhd, hdlr, minf)
+
+	return box("trak", tkhd, box("edts", elst), mdia), trackDuration
+}
+
+func (t *mp4Track) stbl(durations []uint32) []byte {
+	stsd := fullBox("stsd", 0, 0, pack(uint32(1)), t.sampleEntry)
+
+	// stts: 相同时长的连续样本合并为一项
+	var stts [][]byte
+	for i := 0; i < len(durations); {
+		j := i
+		for j < len(durations) && durations[j] == durations[i] {
+			j++
+		}
+		stts = append(stts, pack(uint32(j-i), durations[i]))
+		i = j
+	}
+
+	parts := [][]byte{
+		stsd,
+		fullBox("stts", 0, 0, append([][]byte{pack(uint32(len(stts)))}, stts...)...),
+	}
+
+	// ctts: 仅在存在显示偏移 (B 帧) 时写入
+	hasCTS := false
+	for _, s := range t.samples {
+		if s.cts != 0 {
+			hasCTS = true
+			break
+		}
+	}
+	if hasCTS {
+		var ctts [][]byte
+		for i := 0; i < len(t.samples); {
+			j := i
+			for j < len(t.samples) && t.samples[j].cts == t.samples[i].cts {
+				j++
+			}
+			ctts = append(ctts, pack(uint32(j-i), t.samples[i].cts))
+			i = j
+		}
+		parts = append(parts, fullBox("ctts", 1, 0, append([][]byte{pack(uint32(len(ctts)))}, ctts...)...))
+	}
+
+	// stss: 视频关键帧列表，全部为关键帧时省略
+	if t.handler == "vide" {
+		var sync []byte
+		count := 0
+		for i, s := range t.samples {
+			if s.sync {
+				sync = append(sync, pack(uint32(i+1))...)
+				count++
+			}
+		}
+		if count < len(t.samples) {
+			parts = append(parts, fullBox("stss", 0, 0, pack(uint32(count)), sync))
+		}
+	}
+
+	// stsc: 每个 chunk 的样本数变化时记录一项
+	var stsc [][]byte
+	for i, c := range t.chunks {
+		if i == 0 || c.count != t.chunks[i-1].count {
+			stsc = append(stsc, pack(uint32(i+1), c.count, uint32(1)))
+		}
+	}
+	parts = append(parts, fullBox("stsc", 0, 0, append([][]byte{pack(uint32(len(stsc)))}, stsc...)...))
+
+	sizes := make([]byte, 0, 4*len(t.samples))
+	for _, s := range t.samples {
+		sizes = appendUint32(sizes, s.size)
+	}
+	parts = append(parts, fullBox("stsz", 0, 0, pack(uint32(0), uint32(len(t.samples))), sizes))
+
+	// 文件超过 4GB 时使用 64 位 chunk 偏移
+	large := t.chunks[len(t.chunks)-1].offset > math.MaxUint32
+	offsets := make([]byte, 0, 8*len(t.chunks))
+	for _, c := range t.chunks {
+		if large {
+			offsets = appendUint64(offsets, c.offset)
+		} else {
+			offsets = appendUint32(offsets, uint32(c.offset))
+		}
+	}
+	if large {
+		parts = append(parts, fullBox("co64", 0, 0, pack(uint32(len(t.chunks))), offsets))
+	} else {
+		parts = append(parts, fullBox("stco", 0, 0, pack(uint32(len(t.chunks))), offsets))
+	}
+
+	return box("stbl", parts...)
+}
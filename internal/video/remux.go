@@ -0,0 +1,355 @@
+package video
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/theme"
+	"m3u8-downloader/internal/util"
+)
+
+const (
+	// videoTimescale 视频轨道直接沿用 TS 的 90kHz 时钟
+	videoTimescale = 90000
+	// defaultVideoDuration 无法推算时的默认帧时长 (25fps)
+	defaultVideoDuration = videoTimescale / 25
+	// maxTimestampJump 相邻样本间超过该间隔 (10 秒) 视为时间戳不连续
+	maxTimestampJump = 10 * videoTimescale
+)
+
+// MP4Merger 纯 Go 实现的 TS 转 MP4 合并器
+//
+// 解复用 TS 段中的 H.264/HEVC 视频与 AAC 音频，按 PES 时间戳写入
+// 渐进式 MP4 (moov 位于文件末尾)。不需要 FFmpeg，输出文件扩展名固定为 .mp4。
+// 其他编码的流会被忽略并给出警告。
+type MP4Merger struct {
+	logger logger.Logger
+}
+
+// NewMP4Merger 创建新的 TS 转 MP4 合并器
+func NewMP4Merger(logger logger.Logger) *MP4Merger {
+	return &MP4Merger{
+		logger: logger,
+	}
+}
+
+// Merge 将 TS 段封装为单个 MP4 文件，返回实际输出路径
+func (m *MP4Merger) Merge(segmentDir, outputPath string) (string, error) {
+	tsFiles, err := util.ListTSFiles(segmentDir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(tsFiles) == 0 {
+		return "", errors.New(errors.MergeFailed, "目录中未找到 TS 文件", nil)
+	}
+
+	sort.Strings(tsFiles)
+
+	outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".mp4"
+
+	m.logger.Info("开始封装 %d 个 TS 文件到 %s", len(tsFiles), theme.Lavender+outputPath+theme.Reset)
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return "", errors.New(errors.FileWrite, "创建输出文件失败", err)
+	}
+
+	if err := m.remux(out, segmentDir, tsFiles); err != nil {
+		out.Close()
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	if err := out.Close(); err != nil {
+		return "", errors.New(errors.FileWrite, "关闭输出文件失败", err)
+	}
+
+	if err := m.Validate(outputPath); err != nil {
+		return "", err
+	}
+
+	m.logger.Info("成功合并视频: %s", theme.Lavender+outputPath+theme.Reset)
+	return outputPath, nil
+}
+
+// Validate 验证输出文件
+func (m *MP4Merger) Validate(outputPath string) error {
+	return validateOutput(outputPath)
+}
+
+func (m *MP4Merger) remux(out *os.File, segmentDir string, tsFiles []string) error {
+	mux, err := newMP4Muxer(out)
+	if err != nil {
+		return errors.New(errors.FileWrite, "写入输出文件失败", err)
+	}
+
+	r := newRemuxer(mux)
+	demux := newTSDemuxer(r.handle)
+
+	for _, f := range tsFiles {
+		data, err := util.ReadFile(filepath.Join(segmentDir, f))
+		if err != nil {
+			return err
+		}
+
+		forEachPacket(data, func(pkt []byte) {
+			if err == nil {
+				err = demux.feed(pkt)
+			}
+		})
+		if err != nil {
+			return errors.New(errors.MergeFailed, fmt.Sprintf("解析 %s 失败", f), err)
+		}
+	}
+
+	if err := demux.flush(); err != nil {
+		return errors.New(errors.MergeFailed, "解析 TS 文件失败", err)
+	}
+
+	var unsupported []int
+	for streamType := range demux.unsupported {
+		unsupported = append(unsupported, int(streamType))
+	}
+	sort.Ints(unsupported)
+	for _, streamType := range unsupported {
+		m.logger.Warn("忽略不支持的流类型: 0x%02X", streamType)
+	}
+
+	if r.video == nil && r.audio == nil {
+		return errors.New(errors.MergeFailed, "未找到可封装的 H.264/HEVC 视频或 AAC 音频流", nil)
+	}
+
+	if err := mux.finish(); err != nil {
+		return errors.New(errors.FileWrite, "写入输出文件失败", err)
+	}
+	return nil
+}
+
+// remuxer 把 PES 包转换为 MP4 样本
+//
+// 视频从第一个带参数集的关键帧开始写入；音频按 ADTS 帧拆分，时间按
+// 每帧 1024 个采样累加，仅在出现明显空洞时重新对齐到 PES 时间戳。
+type remuxer struct {
+	mux   *mp4Muxer
+	clock timestampUnwrapper
+
+	video       *mp4Track
+	videoParams map[int][]byte
+	videoBase   int64
+	videoShift  int64
+
+	audio        *mp4Track
+	audioBase    int64
+	audioNext    int64
+	audioPending []byte
+}
+
+func newRemuxer(mux *mp4Muxer) *remuxer {
+	return &remuxer{
+		mux:         mux,
+		videoParams: make(map[int][]byte),
+	}
+}
+
+func (r *remuxer) handle(pes *pesPacket) error {
+	switch pes.streamType {
+	case streamTypeH264, streamTypeHEVC:
+		return r.writeVideo(pes)
+	case streamTypeAAC:
+		return r.writeAudio(pes)
+	}
+	return nil
+}
+
+func (r *remuxer) writeVideo(pes *pesPacket) error {
+	if pes.dts == noTimestamp {
+		return nil
+	}
+
+	hevc := pes.streamType == streamTypeHEVC
+
+	// Annex B 转为 4 字节长度前缀，参数集与分隔符不写入样本
+	var sample []byte
+	keyframe := false
+	for _, nal := range splitNALUnits(pes.data) {
+		var nalType int
+		if hevc {
+			if len(nal) < 2 {
+				continue
+			}
+			nalType = hevcNALType(nal)
+			switch {
+			case nalType == hevcNALVPS || nalType == hevcNALSPS || nalType == hevcNALPPS:
+				r.keepParam(nalType, nal)
+				continue
+			case nalType == hevcNALAUD:
+				continue
+			case hevcKeyframe(nalType):
+				keyframe = true
+			}
+		} else {
+			nalType = int(nal[0] & 0x1F)
+			switch nalType {
+			case h264NALSPS, h264NALPPS:
+				r.keepParam(nalType, nal)
+				continue
+			case h264NALAUD:
+				continue
+			case h264NALIDR:
+				keyframe = true
+			}
+		}
+
+		sample = appendUint32(sample, uint32(len(nal)))
+		sample = append(sample, nal...)
+	}
+
+	if len(sample) == 0 {
+		return nil
+	}
+
+	dts := r.clock.unwrap(pes.dts)
+	pts := relative(pes.pts, pes.dts, dts)
+
+	if r.video == nil {
+		if !keyframe {
+			return nil
+		}
+		track, err := r.newVideoTrack(hevc)
+		if err != nil || track == nil {
+			return err
+		}
+		r.video = track
+		r.videoBase = dts
+		track.startPTS = pts
+	}
+
+	t := r.video
+	if pts < t.startPTS {
+		t.startPTS = pts
+	}
+
+	rel := dts - r.videoBase + r.videoShift
+	if n := len(t.samples); n > 0 {
+		last := t.samples[n-1].dts
+		if rel <= last || rel > last+maxTimestampJump {
+			// 时间戳倒退或跳变: 紧接上一帧继续
+			r.videoShift += last + int64(t.defaultDuration) - rel
+			rel = last + int64(t.defaultDuration)
+		}
+	}
+
+	cts := pts - dts
+	return r.mux.writeSample(t, sample, rel, int32(cts), keyframe)
+}
+
+// keepParam 记录视频轨道创建前出现的参数集
+func (r *remuxer) keepParam(nalType int, nal []byte) {
+	if r.video == nil {
+		r.videoParams[nalType] = append([]byte(nil), nal...)
+	}
+}
+
+// newVideoTrack 参数集齐全时创建视频轨道，否则返回 nil 继续等待
+func (r *remuxer) newVideoTrack(hevc bool) (*mp4Track, error) {
+	var entry []byte
+	var width, height int
+
+	if hevc {
+		vps, sps, pps := r.videoParams[hevcNALVPS], r.videoParams[hevcNALSPS], r.videoParams[hevcNALPPS]
+		if vps == nil || sps == nil || pps == nil {
+			return nil, nil
+		}
+		info, err := parseHEVCSPS(sps)
+		if err != nil {
+			return nil, errors.New(errors.MergeFailed, "解析 HEVC SPS 失败", err)
+		}
+		entry, width, height = hevcSampleEntry(info, vps, sps, pps), info.width, info.height
+	} else {
+		sps, pps := r.videoParams[h264NALSPS], r.videoParams[h264NALPPS]
+		if sps == nil || pps == nil {
+			return nil, nil
+		}
+		info, err := parseH264SPS(sps)
+		if err != nil {
+			return nil, errors.New(errors.MergeFailed, "解析 H.264 SPS 失败", err)
+		}
+		entry, width, height = h264SampleEntry(info, sps, pps), info.width, info.height
+	}
+
+	track := &mp4Track{
+		handler:         "vide",
+		timescale:       videoTimescale,
+		sampleEntry:     entry,
+		width:           width,
+		height:          height,
+		defaultDuration: defaultVideoDuration,
+	}
+	r.mux.addTrack(track)
+	return track, nil
+}
+
+func (r *remuxer) writeAudio(pes *pesPacket) error {
+	data := pes.data
+	continued := len(r.audioPending) > 0
+	if continued {
+		data = append(r.audioPending, data...)
+		r.audioPending = nil
+	}
+
+	var pts int64 = noTimestamp
+	if pes.pts != noTimestamp {
+		pts = r.clock.unwrap(pes.pts)
+	}
+
+	if r.audio != nil && pts != noTimestamp && !continued {
+		// 出现超过两帧的空洞时重新对齐，倒退的时间戳忽略以保证单调
+		expected := (pts - r.audioBase) * int64(r.audio.timescale) / videoTimescale
+		if expected > r.audioNext+2*aacFrameSamples && expected-r.audioNext < 10*int64(r.audio.timescale) {
+			r.audioNext = expected
+		}
+	}
+
+	for len(data) >= 7 {
+		h, err := parseADTS(data)
+		if err != nil {
+			data = data[1:]
+			continue
+		}
+		if h.frameLength > len(data) {
+			break
+		}
+
+		if r.audio == nil {
+			if pts == noTimestamp {
+				return nil
+			}
+			r.audio = &mp4Track{
+				handler:         "soun",
+				timescale:       h.sampleRate(),
+				sampleEntry:     aacSampleEntry(h),
+				startPTS:        pts,
+				defaultDuration: aacFrameSamples,
+			}
+			r.audioBase = pts
+			r.mux.addTrack(r.audio)
+		}
+
+		if err := r.mux.writeSample(r.audio, data[h.headerLength:h.frameLength], r.audioNext, 0, true); err != nil {
+			return err
+		}
+		r.audioNext += aacFrameSamples
+		data = data[h.frameLength:]
+	}
+
+	if len(data) > 0 {
+		r.audioPending = append([]byte(nil), data...)
+	}
+	return nil
+}
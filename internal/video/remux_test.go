@@ -0,0 +1,297 @@
+package video
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"m3u8-downloader/internal/logger"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+)
+
+// bitWriter 测试用的按位写入器
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *bitWriter) u(n int, v uint64) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.data[len(w.data)-1] |= 0x80 >> uint(w.bits%8)
+		}
+		w.bits++
+	}
+}
+
+func (w *bitWriter) ue(v uint64) {
+	n := 0
+	for x := v + 1; x > 1; x >>= 1 {
+		n++
+	}
+	w.u(n, 0)
+	w.u(n+1, v+1)
+}
+
+// testSPS 构造 1920x1088 裁剪为 1080 的 Baseline SPS
+func testSPS() []byte {
+	w := &bitWriter{}
+	w.u(8, 0x67)
+	w.u(8, 66)   // profile_idc
+	w.u(8, 0xC0) // constraint flags
+	w.u(8, 40)   // level_idc
+	w.ue(0)      // seq_parameter_set_id
+	w.ue(0)      // log2_max_frame_num_minus4
+	w.ue(0)      // pic_order_cnt_type
+	w.ue(0)      // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(1)      // max_num_ref_frames
+	w.u(1, 0)    // gaps_in_frame_num_value_allowed_flag
+	w.ue(119)    // pic_width_in_mbs_minus1
+	w.ue(67)     // pic_height_in_map_units_minus1
+	w.u(1, 1)    // frame_mbs_only_flag
+	w.u(1, 1)    // direct_8x8_inference_flag
+	w.u(1, 1)    // frame_cropping_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.u(1, 0) // vui_parameters_present_flag
+	w.u(1, 1) // rbsp_stop_one_bit
+	return w.data
+}
+
+// tsPackets 把负载切分为 TS 包，不足一个包时用适配域填充
+func tsPackets(pid uint16, payload []byte, cc *byte) []byte {
+	var out []byte
+	first := true
+	for len(payload) > 0 {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = 0x47
+		pkt[1] = byte(pid >> 8 & 0x1F)
+		if first {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(pid)
+
+		n := len(payload)
+		if n >= tsPacketSize-4 {
+			n = tsPacketSize - 4
+			pkt[3] = 0x10 | *cc
+			copy(pkt[4:], payload[:n])
+		} else {
+			stuffing := tsPacketSize - 4 - n
+			pkt[3] = 0x30 | *cc
+			pkt[4] = byte(stuffing - 1)
+			for i := 5; i < 4+stuffing; i++ {
+				pkt[i] = 0xFF
+			}
+			if stuffing > 1 {
+				pkt[5] = 0x00
+			}
+			copy(pkt[4+stuffing:], payload[:n])
+		}
+
+		*cc = (*cc + 1) & 0x0F
+		payload = payload[n:]
+		first = false
+		out = append(out, pkt...)
+	}
+	return out
+}
+
+// psi 构造带 pointer_field 的 PSI 节 (CRC 不校验，填 0)
+func psi(tableID byte, body []byte) []byte {
+	length := len(body) + 5 + 4
+	section := []byte{0x00, tableID, 0xB0 | byte(length>>8), byte(length), 0x00, 0x01, 0xC1, 0x00, 0x00}
+	section = append(section, body...)
+	return append(section, 0, 0, 0, 0)
+}
+
+func timestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0E | 1,
+		byte(ts >> 22),
+		byte(ts>>14) | 1,
+		byte(ts >> 7),
+		byte(ts<<1) | 1,
+	}
+}
+
+func pes(streamID byte, pts, dts int64, data []byte) []byte {
+	header := []byte{0x00, 0x00, 0x01, streamID, 0x00, 0x00, 0x80}
+	if dts != pts {
+		header = append(header, 0xC0, 10)
+		header = append(header, timestamp(0x3, pts)...)
+		header = append(header, timestamp(0x1, dts)...)
+	} else {
+		header = append(header, 0x80, 5)
+		header = append(header, timestamp(0x2, pts)...)
+	}
+	return append(header, data...)
+}
+
+func adtsFrame(payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{
+		0xFF, 0xF1,
+		1<<6 | 4<<2, // AAC LC, 44100Hz
+		2<<6 | byte(length>>11),
+		byte(length >> 3),
+		byte(length<<5) | 0x1F,
+		0xFC,
+	}
+	return append(header, payload...)
+}
+
+func annexB(nals ...[]byte) []byte {
+	var out []byte
+	for _, nal := range nals {
+		out = append(out, 0x00, 0x00, 0x00, 0x01)
+		out = append(out, nal...)
+	}
+	return out
+}
+
+// mp4Children 返回指定类型的所有子 box 负载
+func mp4Children(data []byte, typ string) [][]byte {
+	var found [][]byte
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		header := 8
+		if size == 1 {
+			size = int(binary.BigEndian.Uint64(data[8:]))
+			header = 16
+		}
+		if size < header || size > len(data) {
+			break
+		}
+		if string(data[4:8]) == typ {
+			found = append(found, data[header:size])
+		}
+		data = data[size:]
+	}
+	return found
+}
+
+func mp4Path(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		children := mp4Children(data, typ)
+		if len(children) == 0 {
+			return nil
+		}
+		data = children[0]
+	}
+	return data
+}
+
+// TestMP4MergerRemux 测试 H.264 + AAC 的 TS 段封装为 MP4
+func TestMP4MergerRemux(t *testing.T) {
+	dir := t.TempDir()
+
+	var patCC, pmtCC, videoCC, audioCC byte
+	tables := func() []byte {
+		pat := psi(0x00, []byte{0x00, 0x01, 0xE0 | testPMTPID>>8, testPMTPID & 0xFF})
+		pmt := psi(0x02, []byte{
+			0xE1, 0x00, 0xF0, 0x00,
+			streamTypeH264, 0xE1, 0x00, 0xF0, 0x00,
+			streamTypeAAC, 0xE1, 0x01, 0xF0, 0x00,
+			0x06, 0xE1, 0x02, 0xF0, 0x00, // 不支持的私有数据流
+		})
+		return append(tsPackets(0, pat, &patCC), tsPackets(testPMTPID, pmt, &pmtCC)...)
+	}
+
+	sps := testSPS()
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	idr := append([]byte{0x65, 0x88, 0x84}, make([]byte, 300)...)
+	for i := range idr[3:] {
+		idr[3+i] = byte(i%250 + 1)
+	}
+	slice := []byte{0x41, 0x9A, 0x02, 0x03}
+	aud := []byte{0x09, 0xF0}
+
+	const start = 126000
+	audioFrame := adtsFrame([]byte{0x21, 0x10, 0x04, 0x60, 0x8C, 0x1C})
+
+	seg1 := tables()
+	seg1 = append(seg1, tsPackets(testVideoPID, pes(0xE0, start+3000, start, annexB(aud, sps, pps, idr)), &videoCC)...)
+	seg1 = append(seg1, tsPackets(testAudioPID, pes(0xC0, start, start, append(audioFrame, audioFrame...)), &audioCC)...)
+
+	seg2 := tables()
+	seg2 = append(seg2, tsPackets(testVideoPID, pes(0xE0, start+6000, start+3000, annexB(aud, slice)), &videoCC)...)
+	seg2 = append(seg2, tsPackets(testVideoPID, pes(0xE0, start+9000, start+6000, annexB(aud, slice)), &videoCC)...)
+	seg2 = append(seg2, tsPackets(testAudioPID, pes(0xC0, start+4180, start+4180, append(audioFrame, audioFrame...)), &audioCC)...)
+
+	os.WriteFile(filepath.Join(dir, "00001.ts"), seg1, 0666)
+	os.WriteFile(filepath.Join(dir, "00002.ts"), seg2, 0666)
+
+	outDir := t.TempDir()
+	out, err := NewMP4Merger(logger.New("fatal")).Merge(dir, filepath.Join(outDir, "movie.ts"))
+	if err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+
+	if filepath.Ext(out) != ".mp4" {
+		t.Errorf("期望输出 .mp4 文件, 得到 %s", out)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ftyp := mp4Path(data, "ftyp"); ftyp == nil || string(ftyp[:4]) != "isom" {
+		t.Fatalf("缺少 ftyp 或品牌错误")
+	}
+	mdat := mp4Path(data, "mdat")
+	if mdat == nil {
+		t.Fatalf("缺少 mdat")
+	}
+
+	traks := mp4Children(mp4Path(data, "moov"), "trak")
+	if len(traks) != 2 {
+		t.Fatalf("期望 2 个轨道, 得到 %d", len(traks))
+	}
+
+	samples := map[string]uint32{}
+	var total uint32
+	for _, trak := range traks {
+		hdlr := mp4Path(trak, "mdia", "hdlr")
+		handler := string(hdlr[8:12])
+
+		stsz := mp4Path(trak, "mdia", "minf", "stbl", "stsz")
+		count := binary.BigEndian.Uint32(stsz[8:])
+		samples[handler] = count
+		for i := uint32(0); i < count; i++ {
+			total += binary.BigEndian.Uint32(stsz[12+4*i:])
+		}
+
+		if handler == "vide" {
+			tkhd := mp4Path(trak, "tkhd")
+			width := binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16
+			height := binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16
+			if width != 1920 || height != 1080 {
+				t.Errorf("期望 1920x1080, 得到 %dx%d", width, height)
+			}
+			stsd := mp4Path(trak, "mdia", "minf", "stbl", "stsd")
+			if mp4Path(stsd[8:], "avc1") == nil {
+				t.Errorf("视频样本描述不是 avc1")
+			}
+		}
+	}
+
+	if samples["vide"] != 3 || samples["soun"] != 4 {
+		t.Errorf("期望 3 个视频样本、4 个音频样本, 得到 %v", samples)
+	}
+	if int(total) != len(mdat) {
+		t.Errorf("样本总大小 %d 与 mdat 负载 %d 不一致", total, len(mdat))
+	}
+}
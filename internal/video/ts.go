@@ -0,0 +1,170 @@
+package video
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/logger"
+	"m3u8-downloader/internal/theme"
+	"m3u8-downloader/internal/util"
+)
+
+const (
+	// tsPacketSize MPEG-TS 包长度
+	tsPacketSize = 188
+	// nullPID 空包 PID，不参与连续性计数
+	nullPID = 0x1FFF
+)
+
+// TSMerger 纯 Go 实现的 TS 拼接合并器
+//
+// 按文件名顺序把所有段写入同一个 MPEG-TS 文件，并重写每个 PID 的
+// continuity_counter，使拼接处不会被播放器判定为丢包。不需要 FFmpeg，
+// 输出文件扩展名固定为 .ts。
+type TSMerger struct {
+	logger logger.Logger
+}
+
+// NewTSMerger 创建新的 TS 拼接合并器
+func NewTSMerger(logger logger.Logger) *TSMerger {
+	return &TSMerger{
+		logger: logger,
+	}
+}
+
+// Merge 将 TS 段拼接为单个 TS 文件，返回实际输出路径
+func (m *TSMerger) Merge(segmentDir, outputPath string) (string, error) {
+	tsFiles, err := util.ListTSFiles(segmentDir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(tsFiles) == 0 {
+		return "", errors.New(errors.MergeFailed, "目录中未找到 TS 文件", nil)
+	}
+
+	sort.Strings(tsFiles)
+
+	outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".ts"
+
+	m.logger.Info("开始拼接 %d 个 TS 文件到 %s", len(tsFiles), theme.Lavender+outputPath+theme.Reset)
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return "", errors.New(errors.FileWrite, "创建输出文件失败", err)
+	}
+
+	w := bufio.NewWriterSize(out, 1<<20)
+	cc := newContinuityFixer()
+
+	for _, f := range tsFiles {
+		data, err := util.ReadFile(filepath.Join(segmentDir, f))
+		if err != nil {
+			out.Close()
+			return "", err
+		}
+
+		if _, err := w.Write(cc.fix(data)); err != nil {
+			out.Close()
+			return "", errors.New(errors.FileWrite, "写入输出文件失败", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return "", errors.New(errors.FileWrite, "写入输出文件失败", err)
+	}
+	if err := out.Close(); err != nil {
+		return "", errors.New(errors.FileWrite, "关闭输出文件失败", err)
+	}
+
+	if err := m.Validate(outputPath); err != nil {
+		return "", err
+	}
+
+	m.logger.Info("成功合并视频: %s", theme.Lavender+outputPath+theme.Reset)
+	return outputPath, nil
+}
+
+// Validate 验证输出文件
+func (m *TSMerger) Validate(outputPath string) error {
+	return validateOutput(outputPath)
+}
+
+// continuityFixer 跨段维护每个 PID 的 continuity_counter
+type continuityFixer struct {
+	next map[uint16]byte
+}
+
+func newContinuityFixer() *continuityFixer {
+	return &continuityFixer{next: make(map[uint16]byte)}
+}
+
+// fix 返回对齐到包边界的数据，并就地重写连续性计数
+//
+// 丢弃同步字节前的垃圾数据与末尾不完整的包，遇到失步时向后寻找下一个同步点。
+func (c *continuityFixer) fix(data []byte) []byte {
+	out := data[:0]
+
+	forEachPacket(data, func(pkt []byte) {
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if pid != nullPID {
+			c.rewrite(pid, pkt)
+		}
+		out = append(out, pkt...)
+	})
+
+	return out
+}
+
+func (c *continuityFixer) rewrite(pid uint16, pkt []byte) {
+	hasPayload := pkt[3]&0x10 != 0
+	cc := pkt[3] & 0x0F
+
+	next, seen := c.next[pid]
+	if !seen {
+		// 第一次出现的 PID 保留原始计数作为起点
+		c.next[pid] = (cc + 1) & 0x0F
+		return
+	}
+
+	if hasPayload {
+		cc = next
+		c.next[pid] = (next + 1) & 0x0F
+	} else {
+		// 无负载的包不递增计数，沿用上一个值
+		cc = (next - 1) & 0x0F
+	}
+
+	pkt[3] = pkt[3]&0xF0 | cc
+}
+
+// forEachPacket 依次回调数据中每个完整的 TS 包
+func forEachPacket(data []byte, fn func(pkt []byte)) {
+	for i := 0; i+tsPacketSize <= len(data); {
+		if data[i] != util.SyncByte {
+			i = resync(data, i+1)
+			continue
+		}
+
+		fn(data[i : i+tsPacketSize])
+		i += tsPacketSize
+	}
+}
+
+// resync 从 start 开始寻找下一个同步字节，要求其后一个包的位置也是同步字节
+func resync(data []byte, start int) int {
+	for i := start; i < len(data); i++ {
+		if data[i] != util.SyncByte {
+			continue
+		}
+		if i+tsPacketSize >= len(data) || data[i+tsPacketSize] == util.SyncByte {
+			return i
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,70 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"m3u8-downloader/internal/logger"
+)
+
+// packet 构造一个 TS 包
+func packet(pid uint16, cc byte, payload bool) []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0] = 0x47
+	pkt[1] = byte(pid >> 8 & 0x1F)
+	pkt[2] = byte(pid)
+	afc := byte(0x20)
+	if payload {
+		afc = 0x10
+	}
+	pkt[3] = afc | cc&0x0F
+	return pkt
+}
+
+func concat(pkts ...[]byte) []byte {
+	var out []byte
+	for _, p := range pkts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// TestTSMergerFixesContinuity 测试拼接后连续性计数连续
+func TestTSMergerFixesContinuity(t *testing.T) {
+	dir := t.TempDir()
+
+	seg1 := concat(packet(0x100, 7, true), packet(0x100, 8, true), packet(0x100, 8, false))
+	// 第二段从 0 重新计数，开头带有填充字节，末尾有不完整的包
+	seg2 := append([]byte{0x00, 0x00}, concat(packet(0x100, 0, true), packet(0x101, 3, true), packet(0x100, 1, true))...)
+	seg2 = append(seg2, 0x47, 0x01)
+
+	os.WriteFile(filepath.Join(dir, "00001.ts"), seg1, 0666)
+	os.WriteFile(filepath.Join(dir, "00002.ts"), seg2, 0666)
+
+	outDir := t.TempDir()
+	out, err := NewTSMerger(logger.New("fatal")).Merge(dir, filepath.Join(outDir, "movie.mp4"))
+	if err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+
+	if filepath.Ext(out) != ".ts" {
+		t.Errorf("期望输出 .ts 文件, 得到 %s", out)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 6*tsPacketSize {
+		t.Fatalf("期望 6 个包, 得到 %d 字节", len(data))
+	}
+
+	want := []byte{7, 8, 8, 9, 3, 10}
+	for i, cc := range want {
+		if got := data[i*tsPacketSize+3] & 0x0F; got != cc {
+			t.Errorf("包 %d 期望 CC=%d, 得到 %d", i, cc, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package video
+
+// MPEG-TS 中的流类型 (PMT stream_type)
+const (
+	streamTypeAAC  = 0x0F
+	streamTypeH264 = 0x1B
+	streamTypeHEVC = 0x24
+)
+
+// noTimestamp 表示 PES 头中没有 PTS/DTS
+const noTimestamp = -1
+
+// pesPacket 一个完整的 PES 包
+type pesPacket struct {
+	pid        uint16
+	streamType byte
+	pts        int64
+	dts        int64
+	data       []byte
+}
+
+// tsDemuxer 从 TS 包中解析 PAT/PMT 并重组 PES 包
+//
+// 每种类型只取第一个视频流和第一个音频流，不支持的流类型记录在
+// unsupported 中，由调用方决定如何提示。
+type tsDemuxer struct {
+	pmtPIDs     map[uint16]bool
+	streams     map[uint16]byte
+	buffers     map[uint16][]byte
+	hasVideo    bool
+	hasAudio    bool
+	unsupported map[byte]bool
+	onPES       func(pes *pesPacket) error
+}
+
+func newTSDemuxer(onPES func(pes *pesPacket) error) *tsDemuxer {
+	return &tsDemuxer{
+		pmtPIDs:     make(map[uint16]bool),
+		streams:     make(map[uint16]byte),
+		buffers:     make(map[uint16][]byte),
+		unsupported: make(map[byte]bool),
+		onPES:       onPES,
+	}
+}
+
+// feed 处理一个 188 字节的 TS 包
+func (d *tsDemuxer) feed(pkt []byte) error {
+	pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+	pusi := pkt[1]&0x40 != 0
+	afc := (pkt[3] >> 4) & 0x03
+
+	if afc&0x01 == 0 {
+		return nil
+	}
+
+	offset := 4
+	if afc&0x02 != 0 {
+		offset += 1 + int(pkt[4])
+	}
+	if offset >= tsPacketSize {
+		return nil
+	}
+	payload := pkt[offset:]
+
+	switch {
+	case pid == 0:
+		d.parsePAT(psiSection(payload, pusi))
+	case d.pmtPIDs[pid]:
+		d.parsePMT(psiSection(payload, pusi))
+	default:
+		if _, ok := d.streams[pid]; !ok {
+			return nil
+		}
+		if pusi {
+			if err := d.emit(pid); err != nil {
+				return err
+			}
+			d.buffers[pid] = append([]byte(nil), payload...)
+		} else if buf, ok := d.buffers[pid]; ok {
+			d.buffers[pid] = append(buf, payload...)
+		}
+	}
+
+	return nil
+}
+
+// flush 输出所有未完成的 PES 包
+func (d *tsDemuxer) flush() error {
+	for pid := range d.buffers {
+		if err := d.emit(pid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *tsDemuxer) emit(pid uint16) error {
+	buf, ok := d.buffers[pid]
+	if !ok {
+		return nil
+	}
+	delete(d.buffers, pid)
+
+	pes := parsePES(buf)
+	if pes == nil {
+		return nil
+	}
+	pes.pid = pid
+	pes.streamType = d.streams[pid]
+
+	return d.onPES(pes)
+}
+
+// psiSection 跳过 pointer_field，返回去掉 CRC 的节数据 (从 table_id 开始)
+func psiSection(payload []byte, pusi bool) []byte {
+	if !pusi || len(payload) == 0 {
+		return nil
+	}
+
+	pointer := int(payload[0])
+	if 1+pointer+3 > len(payload) {
+		return nil
+	}
+	section := payload[1+pointer:]
+
+	length := int(section[1]&0x0F)<<8 | int(section[2])
+	if length < 4 || 3+length > len(section) {
+		return nil
+	}
+
+	return section[:3+length-4]
+}
+
+func (d *tsDemuxer) parsePAT(section []byte) {
+	if len(section) < 8 || section[0] != 0x00 {
+		return
+	}
+
+	for i := 8; i+4 <= len(section); i += 4 {
+		program := uint16(section[i])<<8 | uint16(section[i+1])
+		pid := uint16(section[i+2]&0x1F)<<8 | uint16(section[i+3])
+		if program != 0 {
+			d.pmtPIDs[pid] = true
+		}
+	}
+}
+
+func (d *tsDemuxer) parsePMT(section []byte) {
+	if len(section) < 12 || section[0] != 0x02 {
+		return
+	}
+
+	programInfoLength := int(section[10]&0x0F)<<8 | int(section[11])
+	for i := 12 + programInfoLength; i+5 <= len(section); {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1F)<<8 | uint16(section[i+2])
+		esInfoLength := int(section[i+3]&0x0F)<<8 | int(section[i+4])
+		i += 5 + esInfoLength
+
+		if _, ok := d.streams[pid]; ok {
+			continue
+		}
+
+		switch streamType {
+		case streamTypeH264, streamTypeHEVC:
+			if !d.hasVideo {
+				d.streams[pid] = streamType
+				d.hasVideo = true
+			}
+		case streamTypeAAC:
+			if !d.hasAudio {
+				d.streams[pid] = streamType
+				d.hasAudio = true
+			}
+		default:
+			d.unsupported[streamType] = true
+		}
+	}
+}
+
+// parsePES 解析 PES 头，返回负载与时间戳
+func parsePES(data []byte) *pesPacket {
+	if len(data) < 9 || data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 {
+		return nil
+	}
+
+	pesLength := int(data[4])<<8 | int(data[5])
+	if pesLength > 0 && 6+pesLength < len(data) {
+		data = data[:6+pesLength]
+	}
+
+	flags := data[7] >> 6
+	headerLength := int(data[8])
+	if 9+headerLength > len(data) {
+		return nil
+	}
+
+	pes := &pesPacket{
+		pts:  noTimestamp,
+		dts:  noTimestamp,
+		data: data[9+headerLength:],
+	}
+
+	if flags&0x02 != 0 && headerLength >= 5 {
+		pes.pts = readTimestamp(data[9:14])
+		pes.dts = pes.pts
+	}
+	if flags == 0x03 && headerLength >= 10 {
+		pes.dts = readTimestamp(data[14:19])
+	}
+
+	return pes
+}
+
+// readTimestamp 读取 33 位 PTS/DTS (90kHz)
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
+
+// timestampUnwrapper 处理 33 位时间戳回绕
+type timestampUnwrapper struct {
+	last   int64
+	offset int64
+	seen   bool
+}
+
+const timestampWrap = int64(1) << 33
+
+func (u *timestampUnwrapper) unwrap(ts int64) int64 {
+	v := ts + u.offset
+	if u.seen && v < u.last-timestampWrap/2 {
+		u.offset += timestampWrap
+		v += timestampWrap
+	}
+	u.last = v
+	u.seen = true
+	return v
+}
+
+// relative 将与 base 同一时间轴的原始时间戳转换为展开后的值
+func relative(raw, rawBase, base int64) int64 {
+	diff := (raw - rawBase) % timestampWrap
+	if diff > timestampWrap/2 {
+		diff -= timestampWrap
+	} else if diff < -timestampWrap/2 {
+		diff += timestampWrap
+	}
+	return base + diff
+}
@@ -0,0 +1,37 @@
+package hls
+
+import (
+	"m3u8-downloader/internal/core"
+	httpClient "m3u8-downloader/internal/http"
+)
+
+// Client 可在多次调用之间共享的 HTTP 客户端，包括连接池、代理与带宽上限
+//
+// 未指定 WithClient 时每次调用创建独立的客户端，调用结束后释放连接。
+type Client struct {
+	hc *httpClient.HTTPClient
+}
+
+// NewClient 按 HTTP 相关的选项 (超时、重试、User-Agent、代理、证书校验与带宽上限) 创建客户端
+func NewClient(opts ...Option) (*Client, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, publicError(err, ErrInvalidConfig)
+	}
+	hc, err := core.NewHTTPClient(o.cfg, o.logger)
+	if err != nil {
+		return nil, publicError(err, ErrInvalidConfig)
+	}
+	return &Client{hc: hc}, nil
+}
+
+// SetRateLimit 调整全局与每个主机的带宽上限 (字节/秒)，0 表示不限，下载过程中调用立即生效
+func (c *Client) SetRateLimit(limit, hostLimit int64) {
+	c.hc.SetRateLimit(limit)
+	c.hc.SetHostRateLimit(hostLimit)
+}
+
+// Close 释放连接池中的空闲连接，客户端不再使用时调用
+func (c *Client) Close() {
+	c.hc.CloseIdleConnections()
+}
@@ -0,0 +1,259 @@
+// Package hls 是 m3u8-downloader 对外的 Go 库接口
+//
+// 下载一个视频分为四步，可以单独使用:
+//
+//	playlist, err := hls.Fetch(ctx, url, hls.WithQuality("720p"))
+//	result, err := hls.Download(ctx, playlist, "video", hls.WithConcurrency(8))
+//	merged, err := hls.Merge(ctx, "video", "video.mp4")
+//
+// 所有函数接受 context，取消后尽快返回并返回 ErrCanceled 错误；选项与命令行参数
+// 一一对应，除 WithLossTolerance 与 WithCleanup 外未指定时使用相同的默认值。
+// 返回的错误为 *Error，可用 IsCode 判断错误码。
+package hls
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"m3u8-downloader/internal/core"
+	"m3u8-downloader/internal/errors"
+	httpClient "m3u8-downloader/internal/http"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/progress"
+	"m3u8-downloader/internal/util"
+)
+
+// Fetch 获取并解析媒体播放列表，遇到主播放列表时按 WithQuality 选择变体，
+// AES-128 密钥在解析时一并获取
+func Fetch(ctx context.Context, url string, opts ...Option) (*Playlist, error) {
+	p, err := fetch(ctx, url, opts)
+	return p, publicError(err, ErrM3U8Parse)
+}
+
+func fetch(ctx context.Context, url string, opts []Option) (*Playlist, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	hc, release, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	fetcher := m3u8.NewFetcher(hc, o.logger)
+	fetcher.SetQuality(o.cfg.Download.Quality)
+	fetcher.SetHostType(o.cfg.Download.HostType)
+
+	manifest, err := fetcher.FetchManifest(ctx, url, o.cfg.Download.RequestHeaders())
+	if err != nil {
+		return nil, canceledOr(ctx, err)
+	}
+	return newPlaylist(manifest), nil
+}
+
+// Parse 解析已获取的媒体播放列表内容，playlistURL 为其地址，用于解析相对路径与获取密钥
+//
+// 主播放列表返回 ErrM3U8Invalid 错误，需要选择变体时使用 Fetch。
+func Parse(ctx context.Context, data []byte, playlistURL string, opts ...Option) (*Playlist, error) {
+	p, err := parse(ctx, data, playlistURL, opts)
+	return p, publicError(err, ErrM3U8Parse)
+}
+
+func parse(ctx context.Context, data []byte, playlistURL string, opts []Option) (*Playlist, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hostURL, err := m3u8.ExtractHost(playlistURL, o.cfg.Download.HostType)
+	if err != nil {
+		return nil, err
+	}
+
+	hc, release, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	parser := m3u8.NewParser(hostURL, hc, o.logger)
+	parser.SetHeaders(o.cfg.Download.RequestHeaders())
+
+	manifest, err := parser.Parse(ctx, string(data))
+	if err != nil {
+		return nil, canceledOr(ctx, err)
+	}
+	manifest.URL = playlistURL
+	return newPlaylist(manifest), nil
+}
+
+// Download 把播放列表的所有段下载到目录 dir，目录中已存在的段直接跳过
+//
+// 失败的段超过 WithLossTolerance 允许的比例时同时返回统计结果与 ErrDownloadFailed
+// 错误；ctx 取消后返回已完成部分的统计结果与 ErrCanceled 错误，再次调用会跳过
+// 已完成的段。
+func Download(ctx context.Context, p *Playlist, dir string, opts ...Option) (*DownloadResult, error) {
+	result, err := download(ctx, p, dir, opts)
+	return result, publicError(err, ErrDownloadFailed)
+}
+
+func download(ctx context.Context, p *Playlist, dir string, opts []Option) (*DownloadResult, error) {
+	start := time.Now()
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	hc, release, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	manifest := p.manifest()
+	dm := core.NewDownloadManager(hc, o.cfg.Download.MaxGoroutines, o.cfg.HTTP.MaxRetries, o.logger)
+	dm.SetHeaders(o.cfg.Download.RequestHeaders())
+	dm.SetReporter(o.reporter())
+
+	if o.sourceURL != "" {
+		if err := util.EnsureDir(dir); err != nil {
+			return nil, err
+		}
+		state := core.NewJobState(dir, o.sourceURL, filepath.Base(dir), o.cfg, manifest)
+		if err := state.Save(); err != nil {
+			o.logger.Warn("保存任务状态失败: %v", err)
+		}
+		dm.SetState(state)
+	}
+
+	err = dm.Download(ctx, manifest, dir)
+
+	stats := dm.GetStats().Snapshot()
+	result := &DownloadResult{
+		Dir:        dir,
+		Total:      int(stats.Total),
+		Downloaded: int(stats.Done - stats.Skipped),
+		Skipped:    int(stats.Skipped),
+		Failed:     int(stats.Failed),
+		Bytes:      stats.Bytes,
+		Elapsed:    time.Since(start),
+	}
+	if err != nil {
+		return result, canceledOr(ctx, err)
+	}
+	if float64(result.Failed) > float64(result.Total)*o.cfg.Download.LossTolerance {
+		return result, errors.New(errors.DownloadFailed,
+			fmt.Sprintf("%d/%d 个段下载失败", result.Failed, result.Total), nil)
+	}
+	return result, nil
+}
+
+// Merge 把目录 dir 中的段合并为 output，合并方式由 WithMerger 指定
+//
+// 合并开始后不响应 ctx 取消。指定 WithCleanup 时合并成功后删除目录中下载的段。
+func Merge(ctx context.Context, dir, output string, opts ...Option) (*MergeResult, error) {
+	result, err := merge(ctx, dir, output, opts)
+	return result, publicError(err, ErrMergeFailed)
+}
+
+func merge(ctx context.Context, dir, output string, opts []Option) (*MergeResult, error) {
+	start := time.Now()
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, canceled(ctx)
+	}
+
+	merger, name, err := core.NewMerger(o.cfg, o.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	o.logger.Info("使用 %s 合并视频...", name)
+	report := o.reporter()
+	report.Report(mergeEvent(progress.MergeStarted, name, output, nil))
+	finalPath, err := merger.Merge(dir, output)
+	if err != nil {
+		report.Report(mergeEvent(progress.MergeFinished, name, output, err))
+		return nil, err
+	}
+	report.Report(mergeEvent(progress.MergeFinished, name, finalPath, nil))
+
+	if o.cfg.Download.AutoClear {
+		core.RemoveDownloadDir(dir, o.logger)
+	}
+
+	result := &MergeResult{Output: finalPath, Merger: name, Elapsed: time.Since(start)}
+	if info, err := os.Stat(finalPath); err == nil {
+		result.Size = info.Size()
+	}
+	return result, nil
+}
+
+// httpClient 返回 WithClient 指定的客户端，未指定时按选项创建，release 在调用结束时释放连接
+func (o *options) httpClient() (hc *httpClient.HTTPClient, release func(), err error) {
+	if o.client != nil {
+		return o.client.hc, func() {}, nil
+	}
+	hc, err = core.NewHTTPClient(o.cfg, o.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hc, hc.CloseIdleConnections, nil
+}
+
+// canceled 返回 ctx 取消对应的错误
+func canceled(ctx context.Context) error {
+	return errors.New(errors.Canceled, "操作已取消", ctx.Err())
+}
+
+// canceledOr ctx 已取消时返回 ErrCanceled 错误，否则原样返回 err
+func canceledOr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return canceled(ctx)
+	}
+	return err
+}
+
+// reporter 把进度事件转发给 WithEvents 与 WithProgress 的回调
+type reporter struct {
+	events   func(Event)
+	progress func(Progress)
+}
+
+func (o *options) reporter() progress.Reporter {
+	return reporter{events: o.events, progress: o.progress}
+}
+
+func (r reporter) Report(event progress.Event) {
+	if r.events != nil {
+		r.events(newEvent(event))
+	}
+	if r.progress == nil || event.Progress == nil {
+		return
+	}
+	switch event.Type {
+	case progress.SegmentSucceeded, progress.SegmentSkipped, progress.SegmentFailed:
+		r.progress(newProgress(*event.Progress))
+	}
+}
+
+// mergeEvent 构造合并开始或结束的事件
+func mergeEvent(eventType progress.EventType, merger, output string, cause error) progress.Event {
+	event := progress.Event{
+		Type:  eventType,
+		Time:  time.Now(),
+		Merge: &progress.Merge{Merger: merger, Output: output},
+	}
+	if cause != nil {
+		event.Error = cause.Error()
+	}
+	return event
+}
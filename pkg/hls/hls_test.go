@@ -0,0 +1,239 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// tsSegment 构造由 n 个 TS 包组成的段
+func tsSegment(n int) []byte {
+	packet := append([]byte{0x47, 0x01, 0x00, 0x10}, bytes.Repeat([]byte{0xff}, 184)...)
+	return bytes.Repeat(packet, n)
+}
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:4.0,
+seg0.ts
+#EXTINF:2.5,
+seg1.ts
+#EXT-X-ENDLIST
+`
+
+// newServer 提供主播放列表、媒体播放列表与两个段，记录请求头 X-Test
+func newServer(t *testing.T) (*httptest.Server, *sync.Map) {
+	headers := &sync.Map{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/video/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nlow/index.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720\nhd/index.m3u8\n"))
+	})
+	for _, variant := range []string{"low", "hd"} {
+		mux.HandleFunc("/video/"+variant+"/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(mediaPlaylist))
+		})
+		for i, name := range []string{"seg0.ts", "seg1.ts"} {
+			data := tsSegment(i + 2)
+			mux.HandleFunc("/video/"+variant+"/"+name, func(w http.ResponseWriter, r *http.Request) {
+				headers.Store(r.URL.Path, r.Header.Get("X-Test"))
+				w.Write(data)
+			})
+		}
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, headers
+}
+
+// TestFetchDownloadMerge 测试选择变体、下载与合并的完整流程
+func TestFetchDownloadMerge(t *testing.T) {
+	server, headers := newServer(t)
+	ctx := context.Background()
+
+	playlist, err := Fetch(ctx, server.URL+"/video/master.m3u8", WithQuality("worst"))
+	if err != nil {
+		t.Fatalf("Fetch 失败: %v", err)
+	}
+	if playlist.URL != server.URL+"/video/low/index.m3u8" {
+		t.Errorf("期望选择最低码率, 得到 %s", playlist.URL)
+	}
+	if len(playlist.Segments) != 2 || !playlist.EndList || playlist.MediaSequence != 10 {
+		t.Fatalf("播放列表解析错误: %+v", playlist)
+	}
+	if playlist.Segments[1].Sequence != 11 || playlist.Duration().Seconds() != 6.5 {
+		t.Errorf("段信息错误: %+v, 时长 %s", playlist.Segments[1], playlist.Duration())
+	}
+
+	dir := filepath.Join(t.TempDir(), "movie")
+	var (
+		mu   sync.Mutex
+		last Progress
+	)
+	result, err := Download(ctx, playlist, dir,
+		WithConcurrency(1),
+		WithHeader("x-test", "hls"),
+		WithProgress(func(p Progress) {
+			mu.Lock()
+			last = p
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatalf("Download 失败: %v", err)
+	}
+	if result.Total != 2 || result.Downloaded != 2 || result.Failed != 0 || result.Bytes != 5*188 {
+		t.Errorf("下载统计错误: %+v", result)
+	}
+	if last.Done != 2 || last.Percent != 100 {
+		t.Errorf("最后的进度错误: %+v", last)
+	}
+	if v, _ := headers.Load("/video/low/seg0.ts"); v != "hls" {
+		t.Errorf("请求头未附加到段请求: %v", v)
+	}
+
+	// 再次下载时跳过已有的段
+	result, err = Download(ctx, playlist, dir)
+	if err != nil {
+		t.Fatalf("Download 失败: %v", err)
+	}
+	if result.Skipped != 2 || result.Downloaded != 0 {
+		t.Errorf("期望跳过 2 个段: %+v", result)
+	}
+
+	merged, err := Merge(ctx, dir, filepath.Join(t.TempDir(), "movie.mp4"), WithMerger("native"))
+	if err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	if filepath.Ext(merged.Output) != ".ts" || merged.Size != 5*188 {
+		t.Errorf("合并结果错误: %+v", merged)
+	}
+	if _, err := os.Stat(merged.Output); err != nil {
+		t.Errorf("输出文件不存在: %v", err)
+	}
+}
+
+// TestParse 测试解析已获取的内容: 相对路径与主播放列表
+func TestParse(t *testing.T) {
+	ctx := context.Background()
+
+	playlist, err := Parse(ctx, []byte(mediaPlaylist), "https://example.com/video/index.m3u8")
+	if err != nil {
+		t.Fatalf("Parse 失败: %v", err)
+	}
+	if playlist.Segments[0].URL != "https://example.com/video/seg0.ts" {
+		t.Errorf("相对路径解析错误: %s", playlist.Segments[0].URL)
+	}
+	if playlist.TargetDuration != 4 {
+		t.Errorf("期望 TARGETDURATION 4, 得到 %v", playlist.TargetDuration)
+	}
+
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow.m3u8\n"
+	if _, err := Parse(ctx, []byte(master), "https://example.com/master.m3u8"); !IsCode(err, ErrM3U8Invalid) {
+		t.Errorf("期望主播放列表返回 %s, 得到 %v", ErrM3U8Invalid, err)
+	}
+}
+
+// TestInvalidOption 测试超出范围的选项与已取消的 context
+func TestInvalidOption(t *testing.T) {
+	_, err := Fetch(context.Background(), "https://example.com/a.m3u8", WithConcurrency(0))
+	var e *Error
+	if !stderrors.As(err, &e) || e.Code != ErrInvalidConfig {
+		t.Errorf("期望并发数 0 返回 %s 错误, 得到 %v", ErrInvalidConfig, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Merge(ctx, t.TempDir(), "out.mp4"); !IsCode(err, ErrCanceled) || !stderrors.Is(err, context.Canceled) {
+		t.Errorf("期望 %s 错误, 得到 %v", ErrCanceled, err)
+	}
+	if _, err := Fetch(ctx, "https://example.com/a.m3u8"); !IsCode(err, ErrCanceled) {
+		t.Errorf("期望 %s 错误, 得到 %v", ErrCanceled, err)
+	}
+
+	playlist := &Playlist{Segments: []Segment{{Name: "00000.ts", URL: "https://example.com/seg0.ts"}}}
+	if _, err := Download(ctx, playlist, t.TempDir()); !IsCode(err, ErrCanceled) {
+		t.Errorf("期望 %s 错误, 得到 %v", ErrCanceled, err)
+	}
+}
+
+// TestDownloadJobStateAndCleanup 测试共享客户端、允许的失败比例、任务状态、事件回调与合并后清理
+func TestDownloadJobStateAndCleanup(t *testing.T) {
+	server, _ := newServer(t)
+	ctx := context.Background()
+
+	client, err := NewClient(WithRetries(1))
+	if err != nil {
+		t.Fatalf("NewClient 失败: %v", err)
+	}
+	defer client.Close()
+	client.SetRateLimit(0, 0)
+
+	playlistURL := server.URL + "/video/hd/index.m3u8"
+	playlist, err := Fetch(ctx, playlistURL, WithClient(client))
+	if err != nil {
+		t.Fatalf("Fetch 失败: %v", err)
+	}
+	playlist.Segments = append(playlist.Segments, Segment{Name: "00003.ts", URL: server.URL + "/video/hd/missing.ts"})
+
+	dir := filepath.Join(t.TempDir(), "movie")
+	if _, err := Download(ctx, playlist, dir, WithClient(client), WithRetries(1)); !IsCode(err, ErrDownloadFailed) {
+		t.Fatalf("期望 %s 错误, 得到 %v", ErrDownloadFailed, err)
+	}
+
+	var failed []Event
+	onFailed := func(event Event) {
+		if event.Type == EventSegmentFailed {
+			failed = append(failed, event)
+		}
+	}
+	result, err := Download(ctx, playlist, dir, WithClient(client), WithRetries(1), WithLossTolerance(0.5),
+		WithJobState(playlistURL), WithEvents(onFailed), WithConcurrency(1))
+	if err != nil {
+		t.Fatalf("允许失败比例内的 Download 失败: %v", err)
+	}
+	if len(failed) != 1 || failed[0].Segment == nil || failed[0].Segment.Name != "00003.ts" ||
+		failed[0].Progress == nil || failed[0].Progress.Failed != 1 || failed[0].Error == "" {
+		t.Errorf("段失败事件错误: %+v", failed)
+	}
+	// 新的任务状态无法校验已有的段，重新下载
+	if result.Failed != 1 || result.Downloaded != 2 {
+		t.Errorf("下载统计错误: %+v", result)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "job.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("任务状态未保存: %v", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		events []EventType
+	)
+	onEvent := func(event Event) {
+		if event.Merge == nil || event.Merge.Merger != "TS 拼接" {
+			t.Errorf("合并事件缺少合并器信息: %+v", event)
+		}
+		mu.Lock()
+		events = append(events, event.Type)
+		mu.Unlock()
+	}
+	merged, err := Merge(ctx, dir, filepath.Join(t.TempDir(), "movie.mp4"), WithMerger("native"), WithCleanup(), WithEvents(onEvent))
+	if err != nil {
+		t.Fatalf("Merge 失败: %v", err)
+	}
+	if len(events) != 2 || events[0] != EventMergeStarted || events[1] != EventMergeFinished {
+		t.Errorf("合并事件错误: %v", events)
+	}
+	if merged.Merger != "TS 拼接" {
+		t.Errorf("合并器错误: %s", merged.Merger)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("合并后应删除下载目录: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package hls
+
+import (
+	"net/textproto"
+	"time"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/logger"
+)
+
+// Option 调整 Fetch、Parse、Download 与 Merge 的行为，未指定的选项使用命令行的默认值
+type Option func(*options)
+
+// options 选项最终写入与命令行相同的配置，由配置的校验检查取值范围
+type options struct {
+	cfg      *config.Config
+	logger   logger.Logger
+	progress func(Progress)
+	events   func(Event)
+	client   *Client
+	// sourceURL 非空时 Download 在目录中保存任务状态
+	sourceURL string
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{cfg: config.DefaultConfig(), logger: adaptLogger(nil)}
+	// 库默认不容忍失败的段、不删除下载的段，与命令行不同
+	o.cfg.Download.LossTolerance = 0
+	o.cfg.Download.AutoClear = false
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// WithHeader 附加一个请求头，用于播放列表、密钥与段的所有请求
+func WithHeader(name, value string) Option {
+	return func(o *options) {
+		headers := make(map[string]string, len(o.cfg.Download.Headers)+1)
+		for k, v := range o.cfg.Download.Headers {
+			headers[k] = v
+		}
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = value
+		o.cfg.Download.Headers = headers
+	}
+}
+
+// WithHeaders 附加多个请求头
+func WithHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		for name, value := range headers {
+			WithHeader(name, value)(o)
+		}
+	}
+}
+
+// WithCookie 设置请求的 Cookie
+func WithCookie(cookie string) Option {
+	return func(o *options) { o.cfg.Download.Cookie = cookie }
+}
+
+// WithReferer 设置请求头 Referer
+func WithReferer(referer string) Option {
+	return func(o *options) { o.cfg.Download.Referer = referer }
+}
+
+// WithOrigin 设置请求头 Origin
+func WithOrigin(origin string) Option {
+	return func(o *options) { o.cfg.Download.Origin = origin }
+}
+
+// WithQuality 设置遇到主播放列表时的码率选择: best (默认)、worst、720p (高度上限) 或 1500k (带宽上限)
+func WithQuality(quality string) Option {
+	return func(o *options) { o.cfg.Download.Quality = quality }
+}
+
+// WithConcurrency 设置同时下载的段数 (1-256，默认 24)
+func WithConcurrency(n int) Option {
+	return func(o *options) { o.cfg.Download.MaxGoroutines = n }
+}
+
+// WithRetries 设置每个请求的最大尝试次数 (至少为 1，默认 5)
+func WithRetries(n int) Option {
+	return func(o *options) { o.cfg.HTTP.MaxRetries = n }
+}
+
+// WithTimeout 设置建立连接、等待响应头以及响应体两次读取之间的超时
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.cfg.HTTP.Timeout = timeout }
+}
+
+// WithUserAgent 设置请求的 User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) { o.cfg.HTTP.UserAgent = userAgent }
+}
+
+// WithProxy 设置代理地址 (http://, https://, socks5://)，未设置时使用 HTTP_PROXY/HTTPS_PROXY
+func WithProxy(proxy string) Option {
+	return func(o *options) { o.cfg.HTTP.Proxy = proxy }
+}
+
+// WithProxyRules 设置按主机匹配的代理规则 "主机模式=代理地址"，代理地址可为 direct，优先于 WithProxy
+func WithProxyRules(rules ...string) Option {
+	return func(o *options) { o.cfg.HTTP.ProxyRules = rules }
+}
+
+// WithHostType 设置相对路径的拼接方式: v1 (默认) 相对播放列表所在目录，v2 相对站点根路径
+func WithHostType(hostType string) Option {
+	return func(o *options) { o.cfg.Download.HostType = hostType }
+}
+
+// WithInsecureSkipVerify 跳过 HTTPS 证书校验
+func WithInsecureSkipVerify() Option {
+	return func(o *options) { o.cfg.Download.InsecureSkipVerify = true }
+}
+
+// WithRateLimit 设置带宽上限 (字节/秒)，0 表示不限
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(o *options) { o.cfg.Download.LimitRate = bytesPerSecond }
+}
+
+// WithHostRateLimit 设置每个主机单独的带宽上限 (字节/秒)，0 表示不限
+func WithHostRateLimit(bytesPerSecond int64) Option {
+	return func(o *options) { o.cfg.Download.HostLimitRate = bytesPerSecond }
+}
+
+// WithClient 使用共享的客户端，此时超时、代理、证书校验与带宽上限以创建客户端时的选项为准
+func WithClient(c *Client) Option {
+	return func(o *options) { o.client = c }
+}
+
+// WithLossTolerance 设置 Download 允许失败的段的比例 (0-1)，默认 0: 有段失败即返回错误
+func WithLossTolerance(ratio float64) Option {
+	return func(o *options) { o.cfg.Download.LossTolerance = ratio }
+}
+
+// WithJobState 让 Download 在目录中保存任务状态 (job.json)，sourceURL 为 Fetch 的地址
+//
+// 中断后可以用命令行的 resume <目录> 继续。任务状态不保存 Cookie、请求头与代理密码。
+func WithJobState(sourceURL string) Option {
+	return func(o *options) { o.sourceURL = sourceURL }
+}
+
+// WithMerger 设置 Merge 的合并方式: auto (默认)、ffmpeg、mp4 或 native
+func WithMerger(merger string) Option {
+	return func(o *options) { o.cfg.FFmpeg.Merger = merger }
+}
+
+// WithFFmpeg 设置 FFmpeg 的路径与参数，args 为空时使用默认参数 (-c copy -y)
+func WithFFmpeg(path string, args ...string) Option {
+	return func(o *options) {
+		o.cfg.FFmpeg.Path = path
+		if len(args) > 0 {
+			o.cfg.FFmpeg.Options = args
+		}
+	}
+}
+
+// WithoutFFmpeg 让 auto 合并方式不尝试 FFmpeg，直接使用纯 Go 的 MP4 封装
+func WithoutFFmpeg() Option {
+	return func(o *options) { o.cfg.FFmpeg.Enabled = false }
+}
+
+// WithCleanup 让 Merge 成功后删除目录中下载的段与任务状态，目录为空时一并删除
+func WithCleanup() Option {
+	return func(o *options) { o.cfg.Download.AutoClear = true }
+}
+
+// WithLogger 设置日志输出，默认不输出日志
+func WithLogger(l Logger) Option {
+	return func(o *options) { o.logger = adaptLogger(l) }
+}
+
+// WithProgress 设置 Download 的进度回调，每个段完成、跳过或失败时调用，可能被并发调用
+func WithProgress(fn func(Progress)) Option {
+	return func(o *options) { o.progress = fn }
+}
+
+// WithEvents 设置 Download 与 Merge 的事件回调，事件与命令行 -progress json 输出的相同，可能被并发调用
+func WithEvents(fn func(Event)) Option {
+	return func(o *options) { o.events = fn }
+}
+
+// Logger 日志接口，msg 为 fmt 格式串
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// loggerAdapter 把 Logger 适配为内部的日志接口
+type loggerAdapter struct {
+	Logger
+}
+
+func adaptLogger(l Logger) logger.Logger {
+	if l == nil {
+		l = nopLogger{}
+	}
+	// 命令行的日志记录器保留带字段的日志
+	if full, ok := l.(logger.Logger); ok {
+		return full
+	}
+	return loggerAdapter{l}
+}
+
+func (a loggerAdapter) Fatal(msg string, args ...interface{}) {
+	a.Error(msg, args...)
+}
+
+func (a loggerAdapter) DebugWithFields(msg string, fields map[string]interface{}) {
+	a.Debug("%s %v", msg, fields)
+}
+
+func (a loggerAdapter) InfoWithFields(msg string, fields map[string]interface{}) {
+	a.Info("%s %v", msg, fields)
+}
+
+func (a loggerAdapter) ErrorWithFields(msg string, fields map[string]interface{}) {
+	a.Error("%s %v", msg, fields)
+}
+
+// nopLogger 丢弃所有日志
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
@@ -0,0 +1,316 @@
+package hls
+
+import (
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"m3u8-downloader/internal/config"
+	"m3u8-downloader/internal/errors"
+	"m3u8-downloader/internal/m3u8"
+	"m3u8-downloader/internal/progress"
+)
+
+// Error 所有函数返回的错误类型，可用 errors.As 取出错误码
+//
+// ctx 取消时错误码为 ErrCanceled，errors.Is(err, context.Canceled) 依然成立。
+type Error struct {
+	Code    string
+	Message string
+	// Err 底层原因，可能为 nil
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("[%s] %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("[%s] %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 错误码
+const (
+	ErrHTTPRequest    = "HTTP_REQUEST"
+	ErrHTTPTimeout    = "HTTP_TIMEOUT"
+	ErrHTTPStatus     = "HTTP_STATUS"
+	ErrM3U8Parse      = "M3U8_PARSE"
+	ErrM3U8Invalid    = "M3U8_INVALID"
+	ErrDownloadFailed = "DOWNLOAD_FAILED"
+	ErrFFmpegNotFound = "FFMPEG_NOT_FOUND"
+	ErrFFmpegFailed   = "FFMPEG_FAILED"
+	ErrMergeFailed    = "MERGE_FAILED"
+	ErrFileRead       = "FILE_READ"
+	ErrFileWrite      = "FILE_WRITE"
+	ErrDirCreate      = "DIR_CREATE"
+	ErrInvalidURL     = "INVALID_URL"
+	ErrInvalidConfig  = "INVALID_CONFIG"
+	ErrCanceled       = "CANCELED"
+)
+
+// IsCode 检查错误是否为特定错误码
+func IsCode(err error, code string) bool {
+	var e *Error
+	return stderrors.As(err, &e) && e.Code == code
+}
+
+// publicError 把内部错误转换为 *Error，配置错误的错误码为 ErrInvalidConfig，
+// 没有错误码的错误使用 code
+func publicError(err error, code string) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *Error:
+		return e
+	case *errors.Error:
+		return &Error{Code: e.Code, Message: e.Message, Err: e.Err}
+	case *config.ConfigError:
+		return &Error{Code: ErrInvalidConfig, Message: e.Error()}
+	default:
+		return &Error{Code: code, Message: err.Error(), Err: err}
+	}
+}
+
+// 加密方式
+const (
+	MethodNone   = "NONE"
+	MethodAES128 = "AES-128"
+)
+
+// EventType 事件类型
+type EventType string
+
+// 事件类型
+const (
+	EventDownloadStarted  EventType = "download_started"
+	EventSegmentStarted   EventType = "segment_started"
+	EventSegmentSucceeded EventType = "segment_succeeded"
+	EventSegmentFailed    EventType = "segment_failed"
+	EventSegmentSkipped   EventType = "segment_skipped"
+	EventDownloadFinished EventType = "download_finished"
+	EventMergeStarted     EventType = "merge_started"
+	EventMergeFinished    EventType = "merge_finished"
+)
+
+// Event WithEvents 收到的事件，只有与事件类型相关的字段会被设置
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Segment 段事件的信息
+	Segment *SegmentInfo
+	// Merge 合并事件的信息
+	Merge *MergeInfo
+	// Progress 事件发生时的下载进度，仅下载事件
+	Progress *Progress
+	// Error 段下载或合并失败的原因
+	Error string
+}
+
+// SegmentInfo 段事件的信息
+type SegmentInfo struct {
+	// Index 段在播放列表中的位置 (从 0 开始)
+	Index    int
+	Name     string
+	URL      string
+	Duration float64
+	// Bytes 写入磁盘的字节数，仅 EventSegmentSucceeded 与 EventSegmentSkipped
+	Bytes int64
+}
+
+// MergeInfo 合并事件的信息
+type MergeInfo struct {
+	Merger string
+	Output string
+}
+
+// Playlist 媒体播放列表
+type Playlist struct {
+	// URL 媒体播放列表地址，遇到主播放列表时为选中的变体地址
+	URL            string
+	Segments       []Segment
+	MediaSequence  int64
+	TargetDuration float64
+	// EndList 是否包含 #EXT-X-ENDLIST (不包含时可能是直播流)
+	EndList bool
+}
+
+// Duration 返回所有段的总时长
+func (p *Playlist) Duration() time.Duration {
+	var seconds float64
+	for _, segment := range p.Segments {
+		seconds += segment.Duration
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Segment 一个媒体段
+type Segment struct {
+	// Name 下载后保存的文件名
+	Name string
+	URL  string
+	// Duration 时长 (秒)
+	Duration float64
+	// Sequence 媒体序列号
+	Sequence int64
+	// Key 该段的加密密钥，nil 表示未加密
+	Key *Key
+}
+
+// Key 段的加密密钥，Data 为解析时已获取的密钥内容
+type Key struct {
+	Method string
+	URL    string
+	IV     []byte
+	Data   []byte
+}
+
+// DownloadResult Download 的统计结果
+type DownloadResult struct {
+	// Dir 段所在的目录
+	Dir   string
+	Total int
+	// Downloaded 本次下载的段数
+	Downloaded int
+	// Skipped 目录中已存在而跳过的段数
+	Skipped int
+	Failed  int
+	// Bytes 已完成段 (含跳过) 的字节数
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// MergeResult Merge 的结果
+type MergeResult struct {
+	// Output 输出文件路径，合并器可能改变扩展名 (如纯 Go 拼接输出 .ts)
+	Output string
+	// Merger 实际使用的合并器名称
+	Merger string
+	// Size 输出文件大小 (字节)
+	Size    int64
+	Elapsed time.Duration
+}
+
+// Progress Download 过程中的进度
+type Progress struct {
+	Total   int
+	Done    int
+	Skipped int
+	Failed  int
+	// Percent 按媒体时长加权的完成百分比 (0-100)
+	Percent float64
+	// Bytes 已完成段的字节数
+	Bytes int64
+	// EstimatedBytes 预计总大小，无法估算时为 0
+	EstimatedBytes int64
+	// Speed 最近几秒的下载速度 (字节/秒)
+	Speed float64
+	// ETA 预计剩余时间，无法估算时为 -1
+	ETA time.Duration
+}
+
+// newPlaylist 把内部清单转换为公开的播放列表
+func newPlaylist(manifest *m3u8.Manifest) *Playlist {
+	p := &Playlist{
+		URL:            manifest.URL,
+		Segments:       make([]Segment, len(manifest.Segments)),
+		MediaSequence:  manifest.MediaSequence,
+		TargetDuration: manifest.TargetDuration,
+		EndList:        manifest.EndList,
+	}
+
+	// 同一密钥的段共享一个 Key
+	keys := make(map[*m3u8.EncryptionKey]*Key)
+	for i, segment := range manifest.Segments {
+		p.Segments[i] = Segment{
+			Name:     segment.Name,
+			URL:      segment.URL,
+			Duration: segment.Duration,
+			Sequence: segment.Sequence,
+		}
+		if segment.Key == nil {
+			continue
+		}
+		key, ok := keys[segment.Key]
+		if !ok {
+			key = &Key{Method: segment.Key.Method, URL: segment.Key.URL, IV: segment.Key.IV, Data: segment.Key.Data}
+			keys[segment.Key] = key
+		}
+		p.Segments[i].Key = key
+	}
+	return p
+}
+
+// manifest 把播放列表转换回内部清单
+func (p *Playlist) manifest() *m3u8.Manifest {
+	manifest := &m3u8.Manifest{
+		URL:            p.URL,
+		Segments:       make([]*m3u8.TsSegment, len(p.Segments)),
+		MediaSequence:  p.MediaSequence,
+		TargetDuration: p.TargetDuration,
+		EndList:        p.EndList,
+	}
+
+	keys := make(map[*Key]*m3u8.EncryptionKey)
+	for i, segment := range p.Segments {
+		manifest.Segments[i] = &m3u8.TsSegment{
+			Name:     segment.Name,
+			URL:      segment.URL,
+			Duration: segment.Duration,
+			Sequence: segment.Sequence,
+		}
+		if segment.Key == nil {
+			continue
+		}
+		key, ok := keys[segment.Key]
+		if !ok {
+			key = &m3u8.EncryptionKey{Method: segment.Key.Method, URL: segment.Key.URL, IV: segment.Key.IV, Data: segment.Key.Data}
+			keys[segment.Key] = key
+		}
+		manifest.Segments[i].Key = key
+	}
+	return manifest
+}
+
+// newProgress 把内部进度快照转换为公开的进度
+func newProgress(s progress.Snapshot) Progress {
+	eta := time.Duration(-1)
+	if s.ETA >= 0 {
+		eta = time.Duration(s.ETA * float64(time.Second))
+	}
+	return Progress{
+		Total:          int(s.Total),
+		Done:           int(s.Done),
+		Skipped:        int(s.Skipped),
+		Failed:         int(s.Failed),
+		Percent:        s.Percent,
+		Bytes:          s.Bytes,
+		EstimatedBytes: s.EstimatedBytes,
+		Speed:          s.Speed,
+		ETA:            eta,
+	}
+}
+
+// newEvent 把内部进度事件转换为公开的事件
+func newEvent(e progress.Event) Event {
+	event := Event{Type: EventType(e.Type), Time: e.Time, Error: e.Error}
+	if e.Segment != nil {
+		event.Segment = &SegmentInfo{
+			Index:    e.Segment.Index,
+			Name:     e.Segment.Name,
+			URL:      e.Segment.URL,
+			Duration: e.Segment.Duration,
+			Bytes:    e.Segment.Bytes,
+		}
+	}
+	if e.Merge != nil {
+		event.Merge = &MergeInfo{Merger: e.Merge.Merger, Output: e.Merge.Output}
+	}
+	if e.Progress != nil {
+		p := newProgress(*e.Progress)
+		event.Progress = &p
+	}
+	return event
+}